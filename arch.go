@@ -0,0 +1,207 @@
+package mere
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var (
+	errArch            = errors.New("unsupported architecture")
+	errUnsupportedArch = errors.New("architecture not supported by spec")
+)
+
+// Override replaces parts of a spec when it is built for a single architecture. Fields which
+// are empty leave those of the spec unchanged.
+type Override struct {
+	Sources []Source `json:"sources,omitempty" jsonschema_description:"Replaces the sources of the spec"`
+	Build   string   `json:"build,omitempty" jsonschema_description:"Replaces the shell commands of the build stage"`
+	Test    string   `json:"test,omitempty" jsonschema_description:"Replaces the shell commands of the test stage"`
+	Install string   `json:"install,omitempty" jsonschema_description:"Replaces the shell commands of the install stage"`
+	Stages  []Stage  `json:"stages,omitempty" jsonschema_description:"Replaces the custom stages of the spec"`
+	// Env holds variables merged over the spec's env.
+	Env map[string]string `json:"env,omitempty" jsonschema_description:"Environment variables merged over those of the spec"`
+	// Files replaces the files globs of packages, by package name.
+	Files map[string][]string `json:"files,omitempty" jsonschema_description:"Replaces the files globs of packages, by package name"`
+}
+
+// validateOverrides reports overrides of architectures the spec does not support, and of
+// files of packages it does not define.
+func (s *Spec) validateOverrides(errs *SpecErrors) {
+	for _, arch := range sortedKeys(s.Overrides) {
+		field := "overrides." + arch
+		if len(s.Arches) > 0 && !slices.Contains(s.Arches, arch) {
+			errs.add(errArch, s.locator().fieldError(field, "%s is not in arch", arch))
+		}
+		for _, name := range sortedKeys(s.Overrides[arch].Files) {
+			if !slices.ContainsFunc(s.Packages, func(p Package) bool { return p.Name == name }) {
+				errs.add(nil, s.locator().fieldError(field+".files."+name, "no package is named %s", name))
+			}
+		}
+	}
+}
+
+// applyOverride checks that the spec supports its target architecture and replaces its fields
+// with those of the architecture's override, if any. The replaced fields are recorded such that
+// errors are reported at the position of the override in the spec file.
+func (s *Spec) applyOverride() error {
+	if len(s.Arches) > 0 && !slices.Contains(s.Arches, s.arch) {
+		return fmt.Errorf("%w: %s supports %s, not %s", errUnsupportedArch, s.Name, strings.Join(s.Arches, ", "), s.arch)
+	}
+	override, ok := s.Overrides[s.arch]
+	if !ok {
+		return nil
+	}
+	prefix := "overrides." + s.arch + "."
+	s.overridden = make(map[string]string)
+	replace := func(field string, value *string, v string) {
+		if v != "" {
+			*value = v
+			s.overridden[field] = prefix + field
+		}
+	}
+	if override.Sources != nil {
+		s.Sources = override.Sources
+		s.overridden["sources"] = prefix + "sources"
+	}
+	replace("build", &s.Build, override.Build)
+	replace("test", &s.Test, override.Test)
+	replace("install", &s.Install, override.Install)
+	if override.Stages != nil {
+		s.Stages = override.Stages
+		s.overridden["stages"] = prefix + "stages"
+	}
+	if len(override.Env) > 0 {
+		env := make(map[string]string, len(s.Env)+len(override.Env))
+		for key, value := range s.Env {
+			env[key] = value
+		}
+		for key, value := range override.Env {
+			env[key] = value
+			s.overridden["env."+key] = prefix + "env." + key
+		}
+		s.Env = env
+	}
+	for i := range s.Packages {
+		if files, ok := override.Files[s.Packages[i].Name]; ok {
+			s.Packages[i].Files = files
+			s.overridden[fmt.Sprintf("packages.%d.files", i)] = prefix + "files." + s.Packages[i].Name
+		}
+	}
+	return nil
+}
+
+// fieldPath returns the path in the spec file of a field, which is within the override of the
+// target architecture when the override replaced it.
+func (s *Spec) fieldPath(path string) string {
+	for field, replacement := range s.overridden {
+		if path == field {
+			return replacement
+		}
+		if rest, ok := strings.CutPrefix(path, field+"."); ok {
+			return replacement + "." + rest
+		}
+	}
+	return path
+}
+
+// overrideFields returns the templated fields of the overrides of every architecture, which
+// are only rendered once applied. Lint checks them all, whatever the target architecture.
+func (s *Spec) overrideFields() []templatedField {
+	var fields []templatedField
+	for _, arch := range sortedKeys(s.Overrides) {
+		override := s.Overrides[arch]
+		add := func(value *string, format string, args ...any) {
+			fields = append(fields, templatedField{
+				path:  fmt.Sprintf("overrides.%s.", arch) + fmt.Sprintf(format, args...),
+				value: *value,
+				set:   func(v string) { *value = v },
+			})
+		}
+		addEnv := func(env map[string]string, format string, args ...any) {
+			for _, key := range sortedKeys(env) {
+				value := env[key]
+				add(&value, format+"%s", append(args, key)...)
+			}
+		}
+		for i := range override.Sources {
+			add(&override.Sources[i].URL, "sources.%d.url", i)
+		}
+		add(&override.Build, "build")
+		add(&override.Test, "test")
+		add(&override.Install, "install")
+		addEnv(override.Env, "env.")
+		for i := range override.Stages {
+			add(&override.Stages[i].Cmd, "stages.%d.cmd", i)
+			add(&override.Stages[i].Workdir, "stages.%d.workdir", i)
+			addEnv(override.Stages[i].Env, "stages.%d.env.", i)
+		}
+		for _, name := range sortedKeys(override.Files) {
+			for i := range override.Files[name] {
+				add(&override.Files[name][i], "files.%s.%d", name, i)
+			}
+		}
+	}
+	return fields
+}
+
+// sourceArches returns the architectures to construct the spec document root for, such that
+// every source is rendered once: the target architecture, or another one the spec supports, when
+// it uses the sources of the spec, followed by each architecture whose override replaces them.
+func sourceArches(root *yamlv3.Node, target string) []string {
+	var arches, replaced []string
+	if node := mappingValue(root, "arch"); node != nil {
+		for _, arch := range node.Content {
+			arches = append(arches, arch.Value)
+		}
+	}
+	if overrides := mappingValue(root, "overrides"); overrides != nil {
+		for i := 0; i+1 < len(overrides.Content); i += 2 {
+			if mappingValue(overrides.Content[i+1], "sources") != nil {
+				replaced = append(replaced, overrides.Content[i].Value)
+			}
+		}
+	}
+	sort.Strings(replaced)
+	candidates := append([]string{target}, arches...)
+	if len(arches) == 0 {
+		for _, arch := range sortedKeys(goArches) {
+			candidates = append(candidates, goArches[arch])
+		}
+	}
+	for _, arch := range candidates {
+		supported := len(arches) == 0 || slices.Contains(arches, arch)
+		if supported && !slices.Contains(replaced, arch) {
+			return append([]string{arch}, replaced...)
+		}
+	}
+	return replaced
+}
+
+// everySource returns the sources of the spec for every architecture: those of the spec and
+// those of each override replacing them, rendered for their architecture. Overrides other than
+// that of the target architecture are only rendered by constructing the spec again.
+func (s *Spec) everySource() ([]Source, error) {
+	seen := make(map[string]bool)
+	var sources []Source
+	for _, arch := range sourceArches(s.locator().root, s.Arch()) {
+		spec := s
+		if arch != s.Arch() {
+			var err error
+			if spec, err = NewSpec(s.path, append(slices.Clone(s.opts), WithArch(arch))...); err != nil {
+				return nil, err
+			}
+		}
+		for i, source := range spec.Sources {
+			if field := spec.fieldPath(fmt.Sprintf("sources.%d", i)); !seen[field] {
+				seen[field] = true
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources, nil
+}
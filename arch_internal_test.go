@@ -0,0 +1,124 @@
+package mere
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestOverrides(t *testing.T) {
+	t.Parallel()
+	t.Run("Should use the spec as is for an architecture without overrides", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_overrides.yaml", WithLogger(Log{Output: &buf}),
+			WithConfig(Config{}), WithArch("x86_64"))
+		require.NoError(t, err)
+		assert.Equal(t, "x86_64", spec.Arch())
+		assert.Equal(t, "https://musl.libc.org/releases/musl-1.2.5.tar.gz", spec.Sources[0].URL)
+		assert.Equal(t, "./configure\n", spec.Build)
+		assert.Equal(t, map[string]string{"CFLAGS": "-O2", "TARGET": "native"}, spec.Env)
+		assert.Equal(t, []string{"lib/ld-musl-x86_64.so.1", "lib/libc.so"}, spec.Packages[0].Files)
+	})
+	t.Run("Should replace the fields of the target architecture", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_overrides.yaml", WithLogger(Log{Output: &buf}),
+			WithConfig(Config{}), WithArch("aarch64"))
+		require.NoError(t, err)
+		require.Len(t, spec.Sources, 1)
+		assert.Equal(t, "https://musl.libc.org/releases/musl-1.2.5-aarch64.tar.gz", spec.Sources[0].URL)
+		assert.Equal(t, "./configure --target=aarch64\n", spec.Build)
+		assert.Equal(t, "make DESTDIR=\"$MERE_PKGDIR\" install\n", spec.Install)
+		assert.Equal(t, map[string]string{"CFLAGS": "-O2", "TARGET": "aarch64-linux-musl"}, spec.Env)
+		assert.Equal(t, []string{"lib/ld-musl-aarch64.so.1", "lib/libc.so"}, spec.Packages[0].Files)
+		assert.Empty(t, spec.Packages[1].Files)
+		assert.Contains(t, spec.buildEnv(nil), "MERE_ARCH=aarch64")
+	})
+	t.Run("Should fail for an architecture the spec does not support", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		_, err := NewSpec("testdata/spec_with_overrides.yaml", WithLogger(Log{Output: &buf}),
+			WithConfig(Config{}), WithArch("riscv64"))
+		require.ErrorIs(t, err, errUnsupportedArch)
+		assert.EqualError(t, err, "architecture not supported by spec: musl supports x86_64, aarch64, not riscv64")
+	})
+	t.Run("Should report invalid overrides at their position", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		_, err := NewSpec("testdata/spec_with_bad_overrides.yaml", WithLogger(Log{Output: &buf}),
+			WithConfig(Config{}), WithArch("aarch64"))
+		var errs *SpecErrors
+		require.True(t, errors.As(err, &errs))
+		require.ErrorIs(t, err, errArch)
+		assert.Equal(t, []FieldError{
+			{
+				File: "testdata/spec_with_bad_overrides.yaml", Line: 15, Column: 9,
+				Field: "overrides.aarch64.files.musl-doc", Message: "no package is named musl-doc",
+			},
+			{
+				File: "testdata/spec_with_bad_overrides.yaml", Line: 17, Column: 5,
+				Field: "overrides.riscv64", Message: "riscv64 is not in arch",
+			},
+		}, errs.Errors)
+	})
+	t.Run("Should report templates of overrides at their position", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec := &Spec{
+			Name:      "musl",
+			Build:     "./configure",
+			Overrides: map[string]Override{"aarch64": {Build: "./configure --target={{.Arh}}"}},
+			arch:      "aarch64",
+			log:       Log{Output: &buf},
+		}
+		require.NoError(t, spec.applyOverride())
+		errs := new(SpecErrors)
+		spec.renderAll(errs)
+		require.Len(t, errs.Errors, 1)
+		assert.Equal(t, "overrides.aarch64.build", errs.Errors[0].Field)
+	})
+}
+
+func Test_sourceArches(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		spec     string
+		target   string
+		expected []string
+	}{
+		{name: "Should render the sources of the spec for the target", spec: "name: a\n", target: "x86_64",
+			expected: []string{"x86_64"}},
+		{
+			name:     "Should add the architectures whose override replaces the sources",
+			spec:     "overrides:\n  riscv64:\n    sources: []\n  aarch64:\n    sources: []\n  i686:\n    build: make\n",
+			target:   "x86_64",
+			expected: []string{"x86_64", "aarch64", "riscv64"},
+		},
+		{
+			name:     "Should render the sources of the spec for another supported architecture",
+			spec:     "arch: [riscv64, aarch64]\noverrides:\n  riscv64:\n    sources: []\n",
+			target:   "riscv64",
+			expected: []string{"aarch64", "riscv64"},
+		},
+		{
+			name:     "Should not render the sources of the spec when every architecture replaces them",
+			spec:     "arch: [riscv64]\noverrides:\n  riscv64:\n    sources: []\n",
+			target:   "x86_64",
+			expected: []string{"riscv64"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var doc yamlv3.Node
+			require.NoError(t, yamlv3.Unmarshal([]byte(tc.spec), &doc))
+			assert.Equal(t, tc.expected, sourceArches(doc.Content[0], tc.target))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package mere
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var errArchive = errors.New("unsupported archive")
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+const tarMagicOffset = 257
+
+// decompress detects the compression used by r from its leading bytes and returns a
+// reader of the decompressed stream.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(fileHeaderBytes)
+	var (
+		dr  io.Reader
+		err error
+	)
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		dr, err = gzip.NewReader(br)
+	case bytes.HasPrefix(header, bzip2Magic):
+		dr = bzip2.NewReader(br)
+	case bytes.HasPrefix(header, xzMagic):
+		dr, err = xz.NewReader(br)
+	case bytes.HasPrefix(header, zstdMagic):
+		var zr *zstd.Decoder
+		zr, err = zstd.NewReader(br)
+		dr = zr
+	case len(header) > tarMagicOffset && bytes.HasPrefix(header[tarMagicOffset:], []byte("ustar")):
+		dr = br
+	default:
+		return nil, fmt.Errorf("%w", errArchive)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return dr, nil
+}
+
+// walkTar calls fn with each header and its contents from the tar archive, which may be compressed.
+func walkTar(filepath string, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer f.Close()
+	r, err := decompress(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath, err)
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// newestModTime returns the most recent modification time of any entry in a tar archive.
+func newestModTime(filepath string) (time.Time, error) {
+	var newest time.Time
+	err := walkTar(filepath, func(header *tar.Header, _ io.Reader) error {
+		if header.ModTime.After(newest) {
+			newest = header.ModTime
+		}
+		return nil
+	})
+	return newest, err
+}
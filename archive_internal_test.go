@@ -0,0 +1,42 @@
+package mere
+
+import (
+	"archive/tar"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newestModTime(t *testing.T) {
+	t.Parallel()
+	t.Run("Should return the newest entry of a compressed tar archive", func(t *testing.T) {
+		t.Parallel()
+		newest, err := newestModTime("testdata/testarchive.tar.gz")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2020, 11, 29, 16, 38, 0, 0, time.UTC), newest.UTC().Truncate(time.Minute))
+	})
+	t.Run("Should fail on files which are not archives", func(t *testing.T) {
+		t.Parallel()
+		_, err := newestModTime("testdata/spec.yaml")
+		require.EqualError(t, err, "testdata/spec.yaml: unsupported archive")
+	})
+	t.Run("Should fail on missing files", func(t *testing.T) {
+		t.Parallel()
+		_, err := newestModTime("testdata/no-such-file")
+		require.EqualError(t, err, "open testdata/no-such-file: no such file or directory")
+	})
+}
+
+func Test_walkTar(t *testing.T) {
+	t.Parallel()
+	t.Run("Should stop when the callback fails", func(t *testing.T) {
+		t.Parallel()
+		err := walkTar("testdata/testarchive.tar.gz", func(*tar.Header, io.Reader) error {
+			return errRead
+		})
+		require.ErrorIs(t, err, errRead)
+	})
+}
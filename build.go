@@ -1,22 +1,31 @@
 package mere
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
-var errBuild = errors.New("build error")
+var (
+	errBuild         = errors.New("build error")
+	errEnforceLimits = errors.New("unable to enforce resource limits")
+)
 
 const (
-	build      = "build"
-	pkg        = "package"
-	src        = "source"
-	merePkgdir = "MERE_PKGDIR"
-	mereSrcdir = "MERE_SRCDIR"
+	waitDelay   = time.Second
+	build       = "build"
+	pkg         = "package"
+	src         = "source"
+	merePkgdir  = "MERE_PKGDIR"
+	mereSrcdir  = "MERE_SRCDIR"
+	mereDepsdir = "MERE_DEPSDIR"
 )
 
 type temper interface {
@@ -42,11 +51,11 @@ func (s slink) symlink(source, target string) error {
 func (s *Spec) createWorkingDir(t temper) (string, error) {
 	var empty string
 	pattern := strings.Join([]string{path.Base(s.Name), s.Version, "*"}, "-")
-	wd, err := t.tempdir(empty, pattern)
+	wd, err := t.tempdir(s.workRoot, pattern)
 	if err != nil {
 		return empty, fmt.Errorf("%w", err)
 	}
-	for _, dir := range []string{build, pkg, src} {
+	for _, dir := range []string{build, pkg, src, logs, depsDir} {
 		if err = ensureDir(os.Mkdir, fmt.Sprintf("%s/%s", wd, dir)); err != nil {
 			return empty, fmt.Errorf("%w", err)
 		}
@@ -54,16 +63,123 @@ func (s *Spec) createWorkingDir(t temper) (string, error) {
 	return wd, err
 }
 
-func (s *Spec) executeStage(stage string) error {
-	cmd := exec.Command("sh", "-c", "set -e\n"+stage) //#nosec
-	cmd.Stdout = s.output
-	cmd.Stderr = os.Stderr
-	cmd.Dir = s.buildContext
-	cmd.Env = []string{
-		fmt.Sprintf("%s=%s/%s", merePkgdir, s.workingDir, pkg),
-		fmt.Sprintf("%s=%s/%s", mereSrcdir, s.workingDir, src),
+// stageCommand returns the command of a stage, running in its own process group so that
+// the command and everything it started are killed when ctx is done. With WithFakeroot it
+// runs in a user namespace as root, and the returned function completes its setup once started.
+func (s *Spec) stageCommand(
+	ctx context.Context, stage Stage, stageLog stageLog,
+) (*exec.Cmd, func(started bool) error, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", "set -e\n"+stage.Cmd) //#nosec
+	useProcessGroup(cmd)
+	var finish func(started bool) error
+	if s.fakeroot {
+		var err error
+		if finish, err = s.useFakeroot(cmd); err != nil {
+			return nil, nil, err
+		}
+	}
+	cmd.WaitDelay = waitDelay
+	cmd.Stdout = io.MultiWriter(s.stdout, stageLog.stdout)
+	cmd.Stderr = io.MultiWriter(s.stderr, stageLog.stderr)
+	cmd.Dir = s.stageDir(stage)
+	cmd.Env = s.buildEnv(stage.Env)
+	return cmd, finish, nil
+}
+
+// stageCgroup creates a cgroup enforcing the configured limits for a stage, below the configured
+// cgroupParent or else below the cgroup of mere. Nil is returned when no limits are configured.
+func (s *Spec) stageCgroup(stage Stage) (*cgroup, error) {
+	if !s.limits.isSet() {
+		return nil, nil //nolint:nilnil // There is no cgroup without limits
+	}
+	parent := s.cgroupParent
+	if parent == "" {
+		var err error
+		if parent, err = ownCgroupParent(); err != nil {
+			return nil, err
+		}
+	}
+	return newCgroup(parent, fmt.Sprintf("mere-%s-%s-", s.Name, stage.Name), s.limits)
+}
+
+// startStage starts cmd, as returned by stageCommand along with finish, inside cg when it is
+// not nil.
+func startStage(cmd *exec.Cmd, finish func(started bool) error, cg *cgroup) error {
+	if finish == nil {
+		finish = func(bool) error { return nil }
+	}
+	if cg != nil {
+		dir, err := os.Open(cg.path)
+		if err != nil {
+			_ = finish(false)
+			return fmt.Errorf("%w: %w", errCgroup, err)
+		}
+		defer dir.Close()
+		useCgroup(cmd.SysProcAttr, int(dir.Fd()))
+	}
+	if err := cmd.Start(); err != nil {
+		_ = finish(false)
+		return err //nolint:wrapcheck // Wrapped by the caller
 	}
-	err := cmd.Run()
+	if err := finish(true); err != nil {
+		// The stage exits once it cannot read that its user namespace is ready.
+		_ = cmd.Wait()
+		return err
+	}
+	return nil
+}
+
+// executeStage runs the command of a stage, killing it when ctx is done or the stage's
+// timeout expires. Resource limits are enforced through a transient cgroup when configured,
+// and the stage fails when they cannot be.
+func (s *Spec) executeStage(ctx context.Context, stage Stage) error {
+	if stage.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stage.timeout)
+		defer cancel()
+	}
+	log := withFields(s.log, "stage", stage.Name)
+	log.Debug("Running:\n" + stage.Cmd)
+	stageLog, closeLogs, err := s.openStageLogs(stage.Name)
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+	start := time.Now()
+	cg, err := s.stageCgroup(stage)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", errEnforceLimits, err)
+		s.recordStage(stage.Name, start, stageUsage{}, err)
+		return err
+	}
+	cmd, finish, err := s.stageCommand(ctx, stage, stageLog)
+	if err == nil {
+		err = startStage(cmd, finish, cg)
+	}
+	if err == nil {
+		err = cmd.Wait()
+	}
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	var usage stageUsage
+	if cmd != nil && cmd.ProcessState != nil {
+		usage = processUsage(cmd.ProcessState)
+	}
+	if cg != nil {
+		// The cgroup also accounts for processes which were not waited for.
+		cgUsage := cg.usage()
+		if cgUsage.peakMemory > 0 {
+			usage.peakMemory = cgUsage.peakMemory
+		}
+		if cgUsage.cpuTime > 0 {
+			usage.cpuTime = cgUsage.cpuTime
+		}
+		if err := cg.remove(); err != nil {
+			log.Warn("Unable to remove cgroup: " + err.Error())
+		}
+	}
+	s.recordStage(stage.Name, start, usage, err)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
@@ -81,8 +197,8 @@ func (s *Spec) setupSymlinks(l linker) error {
 	return nil
 }
 
-func (s *Spec) setupBuildSteps(t temper, l linker) error {
-	errors := s.fetchSources()
+func (s *Spec) setupBuildSteps(ctx context.Context, t temper, l linker) error {
+	errors := s.fetchSources(ctx)
 	if len(errors) != 0 {
 		return fmt.Errorf("%w: %v", errBuild, errors)
 	}
@@ -92,9 +208,18 @@ func (s *Spec) setupBuildSteps(t temper, l linker) error {
 	}
 	s.workingDir = wd
 	s.buildContext = fmt.Sprintf("%s/%s", wd, build)
+	if err := s.setupLogDir(); err != nil {
+		return err
+	}
+
+	s.sourceDateEpoch = s.resolveSourceDateEpoch()
+
+	if err := s.installDeps(); err != nil {
+		return err
+	}
 
 	if len(s.Sources) > 0 {
-		if err := extractArchive(s.Sources[0].savePath, s.buildContext); err != nil {
+		if err := extractArchive(ctx, s.Sources[0].savePath, s.buildContext); err != nil {
 			return err
 		}
 
@@ -109,19 +234,53 @@ func (s *Spec) setupBuildSteps(t temper, l linker) error {
 		}
 	}
 
-	fmt.Fprintf(s.output, "Context directory is %s\n", s.buildContext)
+	s.log.Info("Context directory is " + s.buildContext)
+
+	if err := s.saveState(); err != nil {
+		return err
+	}
 
 	return s.setupSymlinks(l)
 }
 
-func (s *Spec) buildSteps() error {
-	if err := s.setupBuildSteps(tempd{}, slink{}); err != nil {
+// setupLogDir creates the directory in which stage logs are kept, if one was configured.
+func (s *Spec) setupLogDir() error {
+	if s.logDir == "" {
+		return nil
+	}
+	s.persistLogDir = filepath.Join(s.logDir, filepath.Base(s.workingDir))
+	return ensureDir(os.MkdirAll, s.persistLogDir)
+}
+
+func (s *Spec) buildSteps(ctx context.Context) error {
+	stages, err := s.selectStages()
+	if err != nil {
 		return err
 	}
-	for _, stage := range s.buildOrder {
-		if stage["cmd"] != "" {
-			fmt.Fprintf(s.output, "Executing stage %s\n", stage["name"])
-			if err := s.executeStage(stage["cmd"]); err != nil {
+	s.results = nil
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	if s.resumeDir != "" {
+		err = s.resume(s.resumeDir)
+	} else {
+		err = s.setupBuildSteps(ctx, tempd{}, slink{})
+	}
+	if err != nil {
+		return err
+	}
+	s.logEnv()
+	for _, stage := range stages {
+		if stage.Cmd != "" {
+			log := withFields(s.log, "stage", stage.Name)
+			log.Info("Executing stage " + stage.Name)
+			if err := s.executeStage(ctx, stage); err != nil {
+				log.Error(fmt.Sprintf("Stage %s failed: %s", stage.Name, err))
+				if ctx.Err() == nil {
+					s.shellOnFailure(ctx, stage)
+				}
 				return fmt.Errorf("%w", err)
 			}
 		}
@@ -129,12 +288,18 @@ func (s *Spec) buildSteps() error {
 	return nil
 }
 
-// BuildSteps executes the build, test and install steps as defined in a package spec.
-func (s *Spec) BuildSteps() error {
-	return s.buildSteps()
+// BuildSteps executes the stages defined in a package spec, by default build, test and install.
+// Stages may be selected with WithOnlyStages and WithSkipStages, and an existing working
+// directory may be reused with WithResume. The build is aborted when ctx is done, or when
+// the timeout of the spec or a stage expires.
+func (s *Spec) BuildSteps(ctx context.Context) error {
+	return s.buildSteps(ctx)
 }
 
 // Cleanup removes the entire internal working directory.
+// Stage logs written to a directory set with WithLogDir are kept.
 func (s *Spec) Cleanup() {
-	os.RemoveAll(s.workingDir)
+	if err := os.RemoveAll(s.workingDir); err != nil {
+		s.log.Warn("Unable to remove working directory: " + err.Error())
+	}
 }
@@ -2,10 +2,15 @@ package mere
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -40,7 +45,7 @@ func Test_createWorkingDir(t *testing.T) {
 	t.Run("should return an error if creating a tmpdir fails", func(t *testing.T) {
 		t.Parallel()
 		assert := assert.New(t)
-		spec, err := NewSpec("testdata/spec.yaml", &buf)
+		spec, err := NewSpec("testdata/spec.yaml", WithLogger(Log{Output: &buf}))
 		require.NoError(t, err)
 		_, err = spec.createWorkingDir(badTempDir{})
 		assert.EqualError(err, "failure running TempDir")
@@ -48,7 +53,7 @@ func Test_createWorkingDir(t *testing.T) {
 	t.Run("should return an error if unable to create new directories inside the tempdir", func(t *testing.T) {
 		t.Parallel()
 		assert := assert.New(t)
-		spec, err := NewSpec("testdata/spec.yaml", &buf)
+		spec, err := NewSpec("testdata/spec.yaml", WithLogger(Log{Output: &buf}))
 		require.NoError(t, err)
 		_, err = spec.createWorkingDir(badTempDirNoError{})
 		assert.EqualError(err, "mkdir testdata/no-such-file/build: no such file or directory")
@@ -64,7 +69,7 @@ func Test_setupBuildSteps(t *testing.T) {
 		errMsg      string
 		tempDir     temper
 		symlink     linker
-		client      doer
+		client      HTTPClient
 		extractFail bool
 	}{
 		{
@@ -111,15 +116,14 @@ func Test_setupBuildSteps(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			t.Parallel()
 			assert := assert.New(t)
-			spec, err := NewSpec(tc.filename, &buf)
-			require.NoError(t, err)
 			tempdir, err := os.MkdirTemp("", "")
 			require.NoError(t, err)
 			defer os.RemoveAll(tempdir)
-			spec.sourceCache = tempdir
-			spec.httpclient = tc.client
+			spec, err := NewSpec(tc.filename,
+				WithLogger(Log{Output: &buf}), WithSourceCache(tempdir), WithHTTPClient(tc.client))
+			require.NoError(t, err)
 
-			err = spec.setupBuildSteps(tc.tempDir, tc.symlink)
+			err = spec.setupBuildSteps(context.Background(), tc.tempDir, tc.symlink)
 			defer spec.Cleanup()
 			if tc.errMsg == "" {
 				assert.NoError(err)
@@ -155,15 +159,14 @@ func Test_buildSteps(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			t.Parallel()
 			assert := assert.New(t)
-			spec, err := NewSpec(tc.filename, &buf)
-			require.NoError(t, err)
 			tempdir, err := os.MkdirTemp("", "")
 			require.NoError(t, err)
 			defer os.RemoveAll(tempdir)
-			spec.sourceCache = tempdir
-			spec.httpclient = &goodHTTP{}
+			spec, err := NewSpec(tc.filename,
+				WithLogger(Log{Output: &buf}), WithSourceCache(tempdir), WithHTTPClient(&goodHTTP{}))
+			require.NoError(t, err)
 
-			err = spec.buildSteps()
+			err = spec.buildSteps(context.Background())
 			defer spec.Cleanup()
 			if tc.errMsg == "" {
 				assert.NoError(err)
@@ -173,3 +176,155 @@ func Test_buildSteps(t *testing.T) {
 		})
 	}
 }
+
+func Test_executeStage(t *testing.T) {
+	t.Parallel()
+	t.Run("Should provide the configured environment and working directory", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		workRoot := t.TempDir()
+		spec, err := NewSpec("testdata/spec_no_sources.yaml",
+			WithLogger(Log{Output: &buf}), WithWorkDir(workRoot), WithEnv(map[string]string{"FOO": "bar"}))
+		require.NoError(t, err)
+		err = spec.setupBuildSteps(context.Background(), tempd{}, slink{})
+		defer spec.Cleanup()
+		require.NoError(t, err)
+		assert.Equal(t, workRoot, filepath.Dir(spec.workingDir))
+		err = spec.executeStage(context.Background(), Stage{
+			Name: "build",
+			Cmd:  `test "$FOO" = bar && test "$MERE_PKGDIR" = "` + spec.workingDir + `/package"`,
+		})
+		require.NoError(t, err)
+	})
+}
+
+func Test_executeStageOutput(t *testing.T) {
+	t.Parallel()
+	t.Run("Should capture stage stdout and stderr separately from log messages", func(t *testing.T) {
+		t.Parallel()
+		var logbuf, stdout, stderr bytes.Buffer
+		spec, err := NewSpec("testdata/spec_no_sources.yaml",
+			WithLogger(Log{Output: &logbuf}), WithStageOutput(&stdout, &stderr))
+		require.NoError(t, err)
+		require.NoError(t, spec.setupBuildSteps(context.Background(), tempd{}, slink{}))
+		defer spec.Cleanup()
+		spec.log = Log{Output: &logbuf, EnableDebug: true}
+		logbuf.Reset()
+		err = spec.executeStage(context.Background(), Stage{Name: "build", Cmd: "echo out; echo err >&2"})
+		require.NoError(t, err)
+		assert.Equal(t, "out\n", stdout.String())
+		assert.Equal(t, "err\n", stderr.String())
+		assert.Equal(t, "Running:\necho out; echo err >&2\n", logbuf.String())
+	})
+}
+
+func Test_stageLogs(t *testing.T) {
+	t.Parallel()
+	t.Run("Should keep stage logs and a summary in the working and log directories", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		logDir := t.TempDir()
+		spec, err := NewSpec("testdata/spec_with_build_errors.yaml",
+			WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf), WithLogDir(logDir),
+			WithSourceCache(t.TempDir()))
+		require.NoError(t, err)
+		err = spec.BuildSteps(context.Background())
+		require.EqualError(t, err, "exit status 1")
+		workLogs := filepath.Join(spec.workingDir, logs)
+		spec.Cleanup()
+
+		summary := spec.Summary()
+		require.Len(t, summary, 1)
+		assert.Equal(t, "build", summary[0].Name)
+		assert.Equal(t, 1, summary[0].ExitCode)
+		assert.Equal(t, "exit status 1", summary[0].Error)
+		assert.Equal(t, spec.persistLogDir, filepath.Dir(summary[0].LogFile))
+		assert.NoDirExists(t, workLogs)
+
+		data, err := os.ReadFile(filepath.Join(spec.persistLogDir, summaryFile))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"exitCode": 1`)
+		assert.FileExists(t, filepath.Join(spec.persistLogDir, "build.log"))
+
+		// A second build of the same spec starts a new summary.
+		require.Error(t, spec.BuildSteps(context.Background()))
+		defer spec.Cleanup()
+		require.Len(t, spec.Summary(), 1)
+	})
+	t.Run("Should tee combined stage output into the stage log", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_no_sources.yaml",
+			WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf))
+		require.NoError(t, err)
+		require.NoError(t, spec.setupBuildSteps(context.Background(), tempd{}, slink{}))
+		defer spec.Cleanup()
+		require.NoError(t, spec.executeStage(context.Background(), Stage{Name: "check", Cmd: "echo out; echo err >&2"}))
+		data, err := os.ReadFile(filepath.Join(spec.workingDir, logs, "check.log"))
+		require.NoError(t, err)
+		timestamp := `\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z `
+		assert.Regexp(t, "(?m)^"+timestamp+"out$", string(data))
+		assert.Regexp(t, "(?m)^"+timestamp+"err$", string(data))
+		assert.Equal(t, 0, spec.Summary()[0].ExitCode)
+	})
+}
+
+func Test_timestampWriter(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("", 3600))
+	w := &timestampWriter{mu: new(sync.Mutex), w: &buf, now: func() time.Time { return now }}
+	for _, p := range []string{"one\ntw", "o\n", "three\nfour\n", ""} {
+		n, err := w.Write([]byte(p))
+		require.NoError(t, err)
+		assert.Equal(t, len(p), n)
+	}
+	assert.Equal(t, "2024-05-01T11:30:00.000Z one\n2024-05-01T11:30:00.000Z two\n"+
+		"2024-05-01T11:30:00.000Z three\n2024-05-01T11:30:00.000Z four\n", buf.String())
+}
+
+func Test_buildStepsCancellation(t *testing.T) {
+	t.Parallel()
+	t.Run("Should kill the stage process group when the stage timeout expires", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_no_sources.yaml", WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf))
+		require.NoError(t, err)
+		require.NoError(t, spec.setupBuildSteps(context.Background(), tempd{}, slink{}))
+		defer spec.Cleanup()
+		start := time.Now()
+		stage := Stage{Name: "build", Cmd: "sleep 30 & sleep 30", timeout: 200 * time.Millisecond}
+		err = spec.executeStage(context.Background(), stage)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 10*time.Second)
+		assert.Equal(t, -1, spec.Summary()[0].ExitCode)
+	})
+	t.Run("Should abort the build when the spec timeout expires", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_timeout.yaml", WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf))
+		require.NoError(t, err)
+		start := time.Now()
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+	t.Run("Should prefer the WithTimeout option over the spec", func(t *testing.T) {
+		t.Parallel()
+		spec, err := NewSpec("testdata/spec_with_timeout.yaml", WithLogger(Log{Output: io.Discard}), WithTimeout(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, time.Hour, spec.timeout)
+	})
+	t.Run("Should not fetch sources when the context is already cancelled", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_local_file.yaml", WithLogger(Log{Output: &buf}), WithSourceCache(t.TempDir()))
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = spec.BuildSteps(ctx)
+		defer spec.Cleanup()
+		require.EqualError(t, err, "build error: [context canceled]")
+	})
+}
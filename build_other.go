@@ -0,0 +1,14 @@
+//go:build !unix
+
+package mere
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// useProcessGroup only prepares the attributes of cmd, process groups only exist on Unix.
+// Cancelling the command kills its process alone.
+func useProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package mere
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// useProcessGroup runs cmd in its own process group, such that cancelling it kills the
+// command and everything it started.
+func useProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
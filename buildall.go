@@ -0,0 +1,324 @@
+package mere
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Statuses of a spec built by BuildAll.
+const (
+	StatusBuilt   = "built"
+	StatusCached  = "cached"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+var (
+	errCycle      = errors.New("dependency cycle")
+	errProvider   = errors.New("package provided by more than one spec")
+	errDepFailed  = errors.New("dependency failed")
+	errBuildAll   = errors.New("failed to build")
+	errNoSpecsDir = errors.New("no spec files found")
+)
+
+// BuildResult records the outcome of building a single spec with BuildAll.
+type BuildResult struct {
+	Spec      string     `json:"spec"`
+	Path      string     `json:"path"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+}
+
+// SpecPaths returns the path of every .yaml or .yml file below dir, in lexical order.
+func SpecPaths(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNoSpecsDir, dir)
+	}
+	return paths, nil
+}
+
+// SkippedSpec is a spec file which LoadSpecs skipped, as it does not support the target
+// architecture.
+type SkippedSpec struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// LoadSpecs constructs a Spec from every .yaml or .yml file below dir, in lexical order.
+// Spec files which do not support the target architecture, set with WithArch or else the host
+// architecture, are skipped and returned separately.
+func LoadSpecs(dir string, opts ...Option) ([]*Spec, []SkippedSpec, error) {
+	paths, err := SpecPaths(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	specs := make([]*Spec, 0, len(paths))
+	var skipped []SkippedSpec
+	for _, path := range paths {
+		spec, err := NewSpec(path, opts...)
+		if errors.Is(err, errUnsupportedArch) {
+			skipped = append(skipped, SkippedSpec{Path: path, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, skipped, nil
+}
+
+// depNames returns the names of every build and runtime dependency of the spec.
+func (s *Spec) depNames() []string {
+	names := strings.Fields(s.BuildDeps)
+	for _, p := range s.Packages {
+		names = append(names, p.Deps...)
+	}
+	return names
+}
+
+// specDeps returns, for each spec, the indexes of the specs producing its dependencies.
+// Dependencies which no spec produces are expected to be provided by the system.
+func specDeps(specs []*Spec) ([][]int, error) {
+	provider := make(map[string]int)
+	for i, spec := range specs {
+		for _, p := range spec.Packages {
+			if j, ok := provider[p.Name]; ok && j != i {
+				return nil, fmt.Errorf("%w: %s by %s and %s", errProvider, p.Name, specs[j].path, spec.path)
+			}
+			provider[p.Name] = i
+		}
+	}
+	deps := make([][]int, len(specs))
+	for i, spec := range specs {
+		seen := make(map[int]bool)
+		for _, name := range spec.depNames() {
+			j, ok := provider[name]
+			if !ok {
+				spec.log.Debug("Dependency " + name + " is not produced by any spec")
+				continue
+			}
+			if j != i && !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+		sort.Ints(deps[i])
+	}
+	return deps, nil
+}
+
+// topoSort orders specs such that every spec follows the specs it depends on. Specs which
+// do not depend on each other keep their given order.
+func topoSort(specs []*Spec, deps [][]int) ([]int, error) {
+	pending := make([]int, len(specs))
+	dependents := make([][]int, len(specs))
+	for i := range specs {
+		pending[i] = len(deps[i])
+		for _, j := range deps[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+	var ready, order []int
+	for i := range specs {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		i := ready[0]
+		ready = ready[1:]
+		order = append(order, i)
+		for _, j := range dependents[i] {
+			if pending[j]--; pending[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	if len(order) < len(specs) {
+		var names []string
+		for i := range specs {
+			if pending[i] > 0 {
+				names = append(names, specs[i].Name)
+			}
+		}
+		return nil, fmt.Errorf("%w between %s", errCycle, strings.Join(names, ", "))
+	}
+	return order, nil
+}
+
+// buildAll holds the state shared by the builds of BuildAll.
+type buildAll struct {
+	opts  []Option
+	force bool
+	repo  Repo
+	cache BuildCache
+	// repoMu serializes additions to the repo.
+	repoMu sync.Mutex
+}
+
+// build builds the spec at path, or takes its packages from the build cache, and adds them to
+// the repo. The versions of the packages in the repo are part of the spec's build key.
+func (b *buildAll) build(ctx context.Context, path string) ([]Artifact, string, error) {
+	index, err := b.repo.Index()
+	if err != nil {
+		return nil, StatusFailed, err
+	}
+	opts := append(append([]Option{}, b.opts...), WithRepo(b.repo.Path), WithDepVersions(index.Versions()))
+	spec, err := NewSpec(path, opts...)
+	if err != nil {
+		return nil, StatusFailed, err
+	}
+	defer spec.Cleanup()
+	dir, err := os.MkdirTemp(spec.workRoot, spec.Name+"-packages-*")
+	if err != nil {
+		return nil, StatusFailed, fmt.Errorf("%w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	status := StatusCached
+	var artifacts []Artifact
+	var ok bool
+	if !b.force {
+		artifacts, ok, err = b.cache.Get(spec, dir)
+		if err != nil {
+			return nil, StatusFailed, err
+		}
+	}
+	if !ok {
+		status = StatusBuilt
+		if err := spec.BuildSteps(ctx); err != nil {
+			return nil, StatusFailed, err
+		}
+		if artifacts, err = spec.CreatePackages(dir); err != nil {
+			return nil, StatusFailed, err
+		}
+		if err := b.cache.Put(spec, artifacts); err != nil {
+			spec.log.Warn("Unable to cache build: " + err.Error())
+		}
+	}
+	b.repoMu.Lock()
+	defer b.repoMu.Unlock()
+	if err := b.repo.Add(artifacts); err != nil {
+		return nil, StatusFailed, err
+	}
+	for i := range artifacts {
+		artifacts[i].Path = filepath.Join(b.repo.Path, filepath.Base(artifacts[i].Path))
+	}
+	return artifacts, status, nil
+}
+
+// BuildAll builds every spec below dir in dependency order, adding the resulting packages to
+// the repo set with WithRepo, or the configured repo. A spec depends on the specs producing
+// its build dependencies and the dependencies of its packages. Its build dependencies are
+// installed from the repo before it is built.
+//
+// Up to the number of specs set with WithParallel are built at once, by default one. Specs whose
+// packages are in the build cache are not rebuilt unless WithForce is given. When a spec
+// fails, the specs depending on it are skipped, while the others are still built. The results
+// are returned in build order, along with an error naming the failed specs. Specs which do not
+// support the target architecture are not built and follow as skipped, without failing.
+func BuildAll(ctx context.Context, dir string, opts ...Option) ([]BuildResult, error) {
+	o := newOptions(opts)
+	specs, skipped, err := LoadSpecs(dir, opts...)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := specDeps(specs)
+	if err != nil {
+		return nil, err
+	}
+	order, err := topoSort(specs, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &buildAll{
+		opts:  opts,
+		force: o.force,
+		repo:  Repo{Path: o.resolveRepo()},
+		cache: BuildCache{Path: o.resolveBuildCache()},
+	}
+	results := make([]BuildResult, len(specs))
+	done := make([]chan struct{}, len(specs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	slots := make(chan struct{}, max(o.parallel, 1))
+	var wg sync.WaitGroup
+	for _, i := range order {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			result := &results[i]
+			result.Spec = specs[i].Name
+			result.Path = specs[i].path
+			for _, j := range deps[i] {
+				<-done[j]
+				if status := results[j].Status; status == StatusFailed || status == StatusSkipped {
+					result.Status = StatusSkipped
+					result.Error = fmt.Sprintf("%s: %s", errDepFailed, specs[j].Name)
+					return
+				}
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if err := ctx.Err(); err != nil {
+				result.Status = StatusSkipped
+				result.Error = err.Error()
+				return
+			}
+			artifacts, status, err := b.build(ctx, specs[i].path)
+			result.Status = status
+			result.Artifacts = artifacts
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ordered := make([]BuildResult, 0, len(order)+len(skipped))
+	var failed []string
+	for _, i := range order {
+		ordered = append(ordered, results[i])
+		if results[i].Status != StatusBuilt && results[i].Status != StatusCached {
+			failed = append(failed, results[i].Spec)
+		}
+	}
+	for _, spec := range skipped {
+		ordered = append(ordered, BuildResult{
+			Spec:   strings.TrimSuffix(filepath.Base(spec.Path), filepath.Ext(spec.Path)),
+			Path:   spec.Path,
+			Status: StatusSkipped,
+			Error:  spec.Reason,
+		})
+	}
+	if len(failed) > 0 {
+		return ordered, fmt.Errorf("%w: %s", errBuildAll, strings.Join(failed, ", "))
+	}
+	return ordered, nil
+}
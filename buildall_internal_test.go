@@ -0,0 +1,151 @@
+package mere
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildAllOptions(t *testing.T, buf *bytes.Buffer, opts ...Option) []Option {
+	t.Helper()
+	return append([]Option{
+		WithConfig(Config{}), WithLogger(Log{Output: buf}), WithStageOutput(buf, buf),
+		WithRepo(t.TempDir()), WithBuildCache(t.TempDir()),
+	}, opts...)
+}
+
+func TestBuildAll(t *testing.T) {
+	t.Parallel()
+	t.Run("Should build in dependency order and consume packages from the repo", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		opts := buildAllOptions(t, &buf, WithParallel(2))
+		results, err := BuildAll(context.Background(), "testdata/tree", opts...)
+		require.NoError(t, err, buf.String())
+		var names []string
+		for _, result := range results {
+			names = append(names, result.Spec)
+			assert.Equal(t, StatusBuilt, result.Status)
+		}
+		assert.Equal(t, []string{"base", "app", "docs"}, names)
+
+		repo := Repo{Path: filepath.Dir(results[0].Artifacts[0].Path)}
+		index, err := repo.Index()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"app": "2.0-1", "app-docs": "1.0-1", "base-tool": "1.0-1"}, index.Versions())
+		app, _ := index.Lookup("app")
+		assert.Equal(t, map[string]string{"base-tool": "1.0-1"}, app.BuiltWith)
+
+		var readme string
+		err = walkTar(results[1].Artifacts[0].Path, func(header *tar.Header, r io.Reader) error {
+			if header.Name == "share/app/README" {
+				data, _ := io.ReadAll(r)
+				readme = string(data)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "built with base-tool\n", readme)
+
+		results, err = BuildAll(context.Background(), "testdata/tree", opts...)
+		require.NoError(t, err)
+		for _, result := range results {
+			assert.Equal(t, StatusCached, result.Status)
+		}
+		results, err = BuildAll(context.Background(), "testdata/tree", append(opts, WithForce())...)
+		require.NoError(t, err)
+		assert.Equal(t, StatusBuilt, results[0].Status)
+	})
+	t.Run("Should skip the dependents of a failed spec and build the others", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		results, err := BuildAll(context.Background(), "testdata/tree_failing", buildAllOptions(t, &buf)...)
+		require.EqualError(t, err, "failed to build: base, app")
+		statuses := make(map[string]string)
+		for _, result := range results {
+			statuses[result.Spec] = result.Status
+		}
+		assert.Equal(t, map[string]string{"base": StatusFailed, "app": StatusSkipped, "other": StatusBuilt}, statuses)
+		assert.Equal(t, "dependency failed: base", results[1].Error)
+	})
+	t.Run("Should skip specs which do not support the target architecture", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		results, err := BuildAll(context.Background(), "testdata/tree_arch",
+			buildAllOptions(t, &buf, WithArch("riscv64"))...)
+		require.NoError(t, err, buf.String())
+		require.Len(t, results, 2)
+		assert.Equal(t, "any", results[0].Spec)
+		assert.Equal(t, StatusBuilt, results[0].Status)
+		assert.Equal(t, BuildResult{
+			Spec:   "x86",
+			Path:   "testdata/tree_arch/x86.yaml",
+			Status: StatusSkipped,
+			Error:  "architecture not supported by spec: x86 supports x86_64, not riscv64",
+		}, results[1])
+	})
+	t.Run("Should fail on dependency cycles", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		_, err := BuildAll(context.Background(), "testdata/tree_cycle", buildAllOptions(t, &buf)...)
+		require.EqualError(t, err, "dependency cycle between a, b")
+	})
+	t.Run("Should fail without any spec files", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		dir := t.TempDir()
+		_, err := BuildAll(context.Background(), dir, buildAllOptions(t, &buf)...)
+		require.EqualError(t, err, "no spec files found: "+dir)
+	})
+}
+
+func TestLoadSpecs(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		arch    string
+		specs   []string
+		skipped []SkippedSpec
+	}{
+		{arch: "x86_64", specs: []string{"any", "x86"}},
+		{
+			arch:  "aarch64",
+			specs: []string{"any"},
+			skipped: []SkippedSpec{{
+				Path:   "testdata/tree_arch/x86.yaml",
+				Reason: "architecture not supported by spec: x86 supports x86_64, not aarch64",
+			}},
+		},
+	} {
+		t.Run("Should load the specs supporting "+tc.arch, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			specs, skipped, err := LoadSpecs("testdata/tree_arch", WithLogger(Log{Output: &buf}), WithArch(tc.arch))
+			require.NoError(t, err)
+			var names []string
+			for _, spec := range specs {
+				names = append(names, spec.Name)
+			}
+			assert.Equal(t, tc.specs, names)
+			assert.Equal(t, tc.skipped, skipped)
+		})
+	}
+}
+
+func Test_specDeps(t *testing.T) {
+	t.Parallel()
+	t.Run("Should fail when two specs produce the same package", func(t *testing.T) {
+		t.Parallel()
+		specs := []*Spec{
+			{Name: "a", path: "a.yaml", Packages: []Package{{Name: "same"}}},
+			{Name: "b", path: "b.yaml", Packages: []Package{{Name: "same"}}},
+		}
+		_, err := specDeps(specs)
+		require.EqualError(t, err, "package provided by more than one spec: same by a.yaml and b.yaml")
+	})
+}
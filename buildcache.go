@@ -0,0 +1,174 @@
+package mere
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const artifactsFile = "artifacts.json"
+
+// BuildCache keeps the packages of previous builds, so that unchanged specs need not be rebuilt.
+// Each build is stored in a directory named after its build key.
+type BuildCache struct {
+	Path string
+}
+
+// NewBuildCache returns a BuildCache for the configured build cache location.
+func NewBuildCache(opts ...Option) (BuildCache, error) {
+	o := newOptions(opts)
+	return BuildCache{Path: o.resolveBuildCache()}, nil
+}
+
+// BuildKey returns a blake3 sum identifying every input of a build: the rendered spec, the
+// b3sum of each source, the versions of build dependencies and the build environment.
+// Variables of the environment which only name the working directory are excluded, and the
+// working directory is removed from the others.
+func (s *Spec) BuildKey() (string, error) {
+	var key bytes.Buffer
+	spec, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+	fmt.Fprintf(&key, "spec %s\n", spec)
+	for _, source := range s.Sources {
+		fmt.Fprintf(&key, "source %s %s\n", source.cacheName(), source.B3Sum)
+	}
+	deps := strings.Fields(s.BuildDeps)
+	sort.Strings(deps)
+	for _, dep := range deps {
+		fmt.Fprintf(&key, "dep %s %s\n", dep, s.depVersions[dep])
+	}
+	for _, v := range s.buildEnv(nil) {
+		name, _, _ := strings.Cut(v, "=")
+		switch name {
+		case "HOME", merePkgdir, mereSrcdir, mereDepsdir, dateEpoch:
+			continue
+		}
+		if s.workingDir != "" {
+			v = strings.ReplaceAll(v, s.workingDir, "")
+		}
+		fmt.Fprintf(&key, "env %s\n", v)
+	}
+	fmt.Fprintf(&key, "fakeroot %t\n", s.fakeroot)
+	return computeB3Sum(&key)
+}
+
+// cacheable reports whether the packages of the spec's build may be cached. Builds of
+// selected stages, or resuming a previous working directory, are not.
+func (s *Spec) cacheable() bool {
+	return s.resumeDir == "" && len(s.onlyStages) == 0 && len(s.skipStages) == 0
+}
+
+// Get copies the cached packages for the build key of spec into dir. It returns false
+// when there are none, or when the spec's build is not cacheable. A cached build whose
+// archives no longer match their b3sums is ignored.
+func (c BuildCache) Get(spec *Spec, dir string) ([]Artifact, bool, error) {
+	if !spec.cacheable() {
+		return nil, false, nil
+	}
+	key, err := spec.BuildKey()
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(filepath.Join(c.Path, key, artifactsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			spec.log.Debug("No cached build for key " + key)
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("%w", err)
+	}
+	var artifacts []Artifact
+	if err := json.Unmarshal(data, &artifacts); err != nil {
+		return nil, false, fmt.Errorf("%w", err)
+	}
+	for _, artifact := range artifacts {
+		cached := filepath.Join(c.Path, key, artifact.Path)
+		if err := checkB3SumFromFile(spec.log, cached, artifact.B3Sum); err != nil {
+			spec.log.Warn("Ignoring cached build " + key + ": " + err.Error())
+			return nil, false, nil
+		}
+	}
+	if err := ensureDir(os.MkdirAll, dir); err != nil {
+		return nil, false, err
+	}
+	for i := range artifacts {
+		dest := filepath.Join(dir, artifacts[i].Path)
+		if err := copyFile(filepath.Join(c.Path, key, artifacts[i].Path), dest); err != nil {
+			return nil, false, err
+		}
+		artifacts[i].Path = dest
+	}
+	spec.log.Info("Using cached build " + key)
+	return artifacts, true, nil
+}
+
+// Put stores the packages created from the build of spec under its build key, replacing
+// any previous entry. Nothing is stored when the spec's build is not cacheable.
+func (c BuildCache) Put(spec *Spec, artifacts []Artifact) error {
+	if !spec.cacheable() {
+		return nil
+	}
+	key, err := spec.BuildKey()
+	if err != nil {
+		return err
+	}
+	if err := ensureDir(os.MkdirAll, c.Path); err != nil {
+		return err
+	}
+	// Populate a temporary directory first, so that a partial entry is never used.
+	tmp, err := os.MkdirTemp(c.Path, "."+key+"-*")
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer os.RemoveAll(tmp)
+	cached := make([]Artifact, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		name := filepath.Base(artifact.Path)
+		if err := copyFile(artifact.Path, filepath.Join(tmp, name)); err != nil {
+			return err
+		}
+		artifact.Path = name
+		cached = append(cached, artifact)
+	}
+	data, _ := json.MarshalIndent(cached, "", "  ")
+	if err := os.WriteFile(filepath.Join(tmp, artifactsFile), data, manifestPerm); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	dest := filepath.Join(c.Path, key)
+	if err := os.RemoveAll(dest); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	spec.log.Info("Stored build " + key)
+	return nil
+}
+
+// copyFile copies the regular file src to dest.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, manifestPerm)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("%w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildKey(t *testing.T, filename string, opts ...Option) string {
+	t.Helper()
+	var buf bytes.Buffer
+	spec, err := NewSpec(filename, append([]Option{WithLogger(Log{Output: &buf}), WithConfig(Config{})}, opts...)...)
+	require.NoError(t, err)
+	key, err := spec.BuildKey()
+	require.NoError(t, err)
+	return key
+}
+
+func TestBuildKey(t *testing.T) {
+	t.Parallel()
+	base := buildKey(t, "testdata/spec.yaml")
+	t.Run("Should be stable for identical inputs", func(t *testing.T) {
+		t.Parallel()
+		assert.Len(t, base, 64)
+		assert.Equal(t, base, buildKey(t, "testdata/spec.yaml", WithWorkDir(t.TempDir())))
+	})
+	t.Run("Should not depend on the working directory", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_no_sources.yaml", WithLogger(Log{Output: &buf}), WithConfig(Config{}))
+		require.NoError(t, err)
+		before, err := spec.BuildKey()
+		require.NoError(t, err)
+		require.NoError(t, spec.setupBuildSteps(context.Background(), tempd{}, slink{}))
+		defer spec.Cleanup()
+		after, err := spec.BuildKey()
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+	})
+	tests := []struct {
+		description string
+		filename    string
+		opts        []Option
+	}{
+		{description: "Should change with the spec", filename: "testdata/spec_local_file.yaml"},
+		{
+			description: "Should change with the build environment",
+			filename:    "testdata/spec.yaml",
+			opts:        []Option{WithEnv(map[string]string{"FOO": "bar"})},
+		},
+		{description: "Should change with fakeroot", filename: "testdata/spec.yaml", opts: []Option{WithFakeroot()}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			assert.NotEqual(t, base, buildKey(t, tc.filename, tc.opts...))
+		})
+	}
+	t.Run("Should change with build dependency versions", func(t *testing.T) {
+		t.Parallel()
+		versions := map[string]string{"make": "4.4-1", "musl": "1.2.5-1"}
+		first := buildKey(t, "testdata/spec_with_packages.yaml", WithDepVersions(versions))
+		assert.NotEqual(t, buildKey(t, "testdata/spec_with_packages.yaml"), first)
+		versions["musl"] = "1.2.5-2"
+		assert.NotEqual(t, first, buildKey(t, "testdata/spec_with_packages.yaml", WithDepVersions(versions)))
+	})
+	t.Run("Should change with the versions of build dependencies in the repo", func(t *testing.T) {
+		t.Parallel()
+		repo := Repo{Path: t.TempDir()}
+		keyFor := func(release int64) string {
+			musl := IndexEntry{Name: "musl", Version: "1.2.5", Release: release}
+			require.NoError(t, repo.writeIndex(Index{Packages: []IndexEntry{musl}}))
+			index, err := repo.Index()
+			require.NoError(t, err)
+			return buildKey(t, "testdata/spec_with_packages.yaml",
+				WithRepo(repo.Path), WithDepVersions(index.Versions()))
+		}
+		first := keyFor(1)
+		assert.Equal(t, first, keyFor(1))
+		assert.NotEqual(t, first, keyFor(2))
+	})
+}
+
+func TestBuildCache(t *testing.T) {
+	t.Parallel()
+	setup := func(t *testing.T) (BuildCache, *Spec, []Artifact) {
+		t.Helper()
+		spec, artifacts, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		cache := BuildCache{Path: t.TempDir()}
+		return cache, spec, artifacts
+	}
+	t.Run("Should return cached packages for an identical build", func(t *testing.T) {
+		t.Parallel()
+		cache, spec, artifacts := setup(t)
+		_, ok, err := cache.Get(spec, t.TempDir())
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		require.NoError(t, cache.Put(spec, artifacts))
+		var buf bytes.Buffer
+		other, err := NewSpec("testdata/spec_with_packages.yaml", WithLogger(Log{Output: &buf}))
+		require.NoError(t, err)
+		dir := t.TempDir()
+		cached, ok, err := cache.Get(other, dir)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Len(t, cached, len(artifacts))
+		for i := range artifacts {
+			assert.Equal(t, filepath.Join(dir, filepath.Base(artifacts[i].Path)), cached[i].Path)
+			assert.Equal(t, artifacts[i].B3Sum, cached[i].B3Sum)
+			assert.Equal(t, artifacts[i].Manifest, cached[i].Manifest)
+			sum, err := computeB3SumFromFile(cached[i].Path)
+			require.NoError(t, err)
+			assert.Equal(t, artifacts[i].B3Sum, sum)
+		}
+		assert.Contains(t, buf.String(), "Using cached build")
+	})
+	t.Run("Should ignore cached packages which were modified", func(t *testing.T) {
+		t.Parallel()
+		cache, spec, artifacts := setup(t)
+		require.NoError(t, cache.Put(spec, artifacts))
+		key, err := spec.BuildKey()
+		require.NoError(t, err)
+		archive := filepath.Join(cache.Path, key, filepath.Base(artifacts[0].Path))
+		require.NoError(t, os.WriteFile(archive, []byte("corrupt"), 0o644))
+		var buf bytes.Buffer
+		spec.log = Log{Output: &buf}
+		_, ok, err := cache.Get(spec, t.TempDir())
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Contains(t, buf.String(), "warning: Ignoring cached build "+key)
+	})
+	t.Run("Should not cache builds of selected stages", func(t *testing.T) {
+		t.Parallel()
+		cache, spec, artifacts := setup(t)
+		spec.skipStages = []string{testStage}
+		require.NoError(t, cache.Put(spec, artifacts))
+		entries, err := os.ReadDir(cache.Path)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		_, ok, err := cache.Get(spec, t.TempDir())
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,253 @@
+package mere
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var errBump = errors.New("unable to bump spec")
+
+// BumpedSource records the new b3sum of a source of a bumped spec.
+type BumpedSource struct {
+	URL   string `json:"url"`
+	B3Sum string `json:"b3sum"`
+}
+
+// BumpResult describes the changes made to a spec by Bump.
+type BumpResult struct {
+	Path       string         `json:"path"`
+	OldVersion string         `json:"oldVersion"`
+	Version    string         `json:"version"`
+	Sources    []BumpedSource `json:"sources"`
+}
+
+// scalarEdit replaces the value of a scalar node in a YAML document.
+type scalarEdit struct {
+	node  *yamlv3.Node
+	value string
+}
+
+// formatScalar formats value for the style of the node it replaces. Plain values which YAML
+// would not read as strings, such as 1.10, are double quoted.
+func formatScalar(node *yamlv3.Node, value string, str bool) string {
+	switch node.Style {
+	case yamlv3.DoubleQuotedStyle:
+		return strconv.Quote(value)
+	case yamlv3.SingleQuotedStyle:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	if str {
+		var v any
+		if err := yamlv3.Unmarshal([]byte(value), &v); err != nil {
+			return strconv.Quote(value)
+		}
+		if _, ok := v.(string); !ok {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+// scalarEnd returns the offset in line just past the scalar node starting at start.
+func scalarEnd(node *yamlv3.Node, line string, start int) (int, error) {
+	switch node.Style {
+	case yamlv3.DoubleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+	case yamlv3.SingleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+	case 0:
+		if end := start + len(node.Value); end <= len(line) && line[start:end] == node.Value {
+			return end, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unsupported value at line %d", errBump, node.Line)
+}
+
+// applyEdits replaces the scalars of the given edits in data, leaving everything else,
+// including comments and the order of keys, untouched.
+func applyEdits(data []byte, edits []scalarEdit) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+	sort.Slice(edits, func(i, j int) bool {
+		a, b := edits[i].node, edits[j].node
+		if a.Line != b.Line {
+			return a.Line > b.Line
+		}
+		return a.Column > b.Column
+	})
+	for _, edit := range edits {
+		if edit.node.Line < 1 || edit.node.Line > len(lines) {
+			return nil, fmt.Errorf("%w: no line %d", errBump, edit.node.Line)
+		}
+		line := lines[edit.node.Line-1]
+		start := edit.node.Column - 1
+		end, err := scalarEnd(edit.node, line, start)
+		if err != nil {
+			return nil, err
+		}
+		lines[edit.node.Line-1] = line[:start] + edit.value + line[end:]
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// writeFileAtomic replaces the file at path with data, keeping its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// rehash downloads the source into the source cache, replacing any cached copy, and
+// returns its b3sum.
+func (source *Source) rehash(ctx context.Context, spec *Spec) (string, error) {
+	if err := ensureDir(os.MkdirAll, spec.sourceCache); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(spec.sourceCache, "."+source.cacheName()+"-*")
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := source.download(ctx, spec, tmp.Name()); err != nil {
+		return "", err
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+	sum, err := computeB3Sum(f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(spec.sourceCache, source.cacheName())); err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+	return sum, nil
+}
+
+// Bump updates the spec file at path to version. It resets the release to 1, downloads every
+// source from its URL rendered for the new version and replaces the b3sum of each source,
+// including the sources of the overrides of every architecture.
+// The file is edited in place, such that comments, key order and quoting are preserved.
+// Downloaded sources are kept in the source cache.
+func Bump(ctx context.Context, path, version string, opts ...Option) (BumpResult, error) {
+	result := BumpResult{Path: path, Version: version}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return result, fmt.Errorf("%w", err)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return result, fmt.Errorf("%w: %s: %w", errBump, path, err)
+	}
+	if len(doc.Content) == 0 {
+		return result, fmt.Errorf("%w: %s is empty", errBump, path)
+	}
+	root := doc.Content[0]
+	versionNode, releaseNode := mappingValue(root, "version"), mappingValue(root, "release")
+	if versionNode == nil || releaseNode == nil {
+		return result, fmt.Errorf("%w: %s has no version or release", errBump, path)
+	}
+	result.OldVersion = versionNode.Value
+	edits := []scalarEdit{
+		{node: versionNode, value: formatScalar(versionNode, version, true)},
+		{node: releaseNode, value: formatScalar(releaseNode, "1", false)},
+	}
+
+	// Construct the spec from the bumped file to render the URLs of its sources.
+	bumped, err := applyEdits(data, append([]scalarEdit{}, edits...))
+	if err != nil {
+		return result, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*"+filepath.Ext(path))
+	if err != nil {
+		return result, fmt.Errorf("%w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(bumped)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return result, fmt.Errorf("%w", err)
+	}
+	o := newOptions(opts)
+	rehashed := make(map[string]bool)
+	for _, arch := range sourceArches(root, valueOr(o.arch, hostArch())) {
+		spec, err := NewSpec(tmp.Name(), append(append([]Option{}, opts...), WithArch(arch))...)
+		if err != nil {
+			return result, err
+		}
+		for i := range spec.Sources {
+			field := spec.fieldPath(fmt.Sprintf("sources.%d", i))
+			if rehashed[field] {
+				continue
+			}
+			rehashed[field] = true
+			node, _ := lookupNode(root, field)
+			sumNode := mappingValue(node, "b3sum")
+			if sumNode == nil {
+				return result, fmt.Errorf("%w: %s has no b3sum", errBump, field)
+			}
+			sum, err := spec.Sources[i].rehash(ctx, spec)
+			if err != nil {
+				return result, err
+			}
+			spec.log.Info(fmt.Sprintf("New b3sum of %s: %s", spec.Sources[i].URL, sum))
+			result.Sources = append(result.Sources, BumpedSource{URL: spec.Sources[i].URL, B3Sum: sum})
+			edits = append(edits, scalarEdit{node: sumNode, value: formatScalar(sumNode, sum, true)})
+		}
+	}
+
+	if bumped, err = applyEdits(data, edits); err != nil {
+		return result, err
+	}
+	if err := writeFileAtomic(path, bumped); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestBump(t *testing.T) {
+	t.Parallel()
+	copySpec := func(t *testing.T, src string) string {
+		t.Helper()
+		data, err := os.ReadFile(src)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "spec.yaml")
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+		return path
+	}
+	t.Run("Should update the version, release and b3sums in place", func(t *testing.T) {
+		t.Parallel()
+		path := copySpec(t, "testdata/spec_bump.yaml")
+		cache := t.TempDir()
+		client := &fixtureHTTP{}
+		var buf bytes.Buffer
+		result, err := Bump(context.Background(), path, "1.10",
+			WithLogger(Log{Output: &buf}), WithHTTPClient(client), WithSourceCache(cache))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"https://example.com/releases/hello-1.10.tar.gz"}, client.requests)
+
+		remote, err := computeB3SumFromFile("testdata/upstream/releases/hello-1.10.tar.gz")
+		require.NoError(t, err)
+		local, err := computeB3SumFromFile("testdata/testarchive.tar.gz")
+		require.NoError(t, err)
+		assert.Equal(t, BumpResult{
+			Path:       path,
+			OldVersion: "1.9.1",
+			Version:    "1.10",
+			Sources: []BumpedSource{
+				{URL: "https://example.com/releases/hello-1.10.tar.gz", B3Sum: remote},
+				{URL: "testdata/testarchive.tar.gz", B3Sum: local},
+			},
+		}, result)
+
+		original, err := os.ReadFile("testdata/spec_bump.yaml")
+		require.NoError(t, err)
+		expected := strings.NewReplacer(
+			"version: 1.9.1 #", `version: "1.10" #`,
+			"release: 3", "release: 1",
+			`"`+strings.Repeat("0", 64)+`"`, `"`+remote+`"`,
+			strings.Repeat("ab", 32), local,
+		).Replace(string(original))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(data))
+		assert.FileExists(t, filepath.Join(cache, "hello-1.10.tar.gz"))
+
+		spec, err := NewSpec(path, WithLogger(Log{Output: &buf}), WithSourceCache(cache))
+		require.NoError(t, err)
+		assert.Equal(t, "1.10", spec.Version)
+		assert.Equal(t, int64(1), spec.Release)
+	})
+	t.Run("Should update the b3sums of the sources of every override", func(t *testing.T) {
+		t.Parallel()
+		path := copySpec(t, "testdata/spec_bump_overrides.yaml")
+		var buf bytes.Buffer
+		result, err := Bump(context.Background(), path, "1.10", WithLogger(Log{Output: &buf}),
+			WithHTTPClient(&fixtureHTTP{}), WithSourceCache(t.TempDir()), WithArch("riscv64"))
+		require.NoError(t, err)
+
+		remote, err := computeB3SumFromFile("testdata/upstream/releases/hello-1.10.tar.gz")
+		require.NoError(t, err)
+		local, err := computeB3SumFromFile("testdata/testarchive.tar.gz")
+		require.NoError(t, err)
+		assert.Equal(t, []BumpedSource{
+			{URL: "https://example.com/releases/hello-1.10.tar.gz", B3Sum: remote},
+			{URL: "testdata/testarchive.tar.gz", B3Sum: local},
+			{URL: "https://example.com/releases/hello-1.10.tar.gz", B3Sum: remote},
+		}, result.Sources)
+
+		original, err := os.ReadFile("testdata/spec_bump_overrides.yaml")
+		require.NoError(t, err)
+		expected := strings.NewReplacer(
+			"version: 1.9.1", `version: "1.10"`,
+			"release: 2", "release: 1",
+			`"`+strings.Repeat("0", 64)+`"`, `"`+remote+`"`,
+			strings.Repeat("cd", 32), local,
+			`"`+strings.Repeat("1", 64)+`"`, `"`+remote+`"`,
+		).Replace(string(original))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(data))
+	})
+	t.Run("Should leave the spec untouched when a source cannot be fetched", func(t *testing.T) {
+		t.Parallel()
+		path := copySpec(t, "testdata/spec_bump.yaml")
+		var buf bytes.Buffer
+		_, err := Bump(context.Background(), path, "1.11",
+			WithLogger(Log{Output: &buf}), WithHTTPClient(&fixtureHTTP{}), WithSourceCache(t.TempDir()))
+		require.Error(t, err)
+		original, err := os.ReadFile("testdata/spec_bump.yaml")
+		require.NoError(t, err)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, string(original), string(data))
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+	t.Run("Should fail without a version", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "spec.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("name: hello\n"), 0o600))
+		_, err := Bump(context.Background(), path, "1.0")
+		require.ErrorIs(t, err, errBump)
+	})
+}
+
+func Test_formatScalar(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		style    yamlv3.Style
+		value    string
+		expected string
+	}{
+		{name: "plain string", value: "1.2.3", expected: "1.2.3"},
+		{name: "plain number", value: "1.10", expected: `"1.10"`},
+		{name: "plain integer", value: "2", expected: `"2"`},
+		{name: "double quoted", style: yamlv3.DoubleQuotedStyle, value: "1.2.3", expected: `"1.2.3"`},
+		{name: "single quoted", style: yamlv3.SingleQuotedStyle, value: "it's", expected: `'it''s'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.expected, formatScalar(&yamlv3.Node{Style: tt.style}, tt.value, true))
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package mere
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errPruneCriteria = errors.New("no prune criteria given")
+
+// CacheEntry describes a single file stored in the source cache.
+type CacheEntry struct {
+	Name    string
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// Specs lists the names of the given specs which reference this file.
+	Specs []string
+	// B3Sum is only populated by Verify.
+	B3Sum string
+	// Valid is only populated by Verify, it is false when a referencing spec expects a different b3sum.
+	Valid bool
+}
+
+// SourceCache provides management of the directory where fetched sources are stored.
+type SourceCache struct {
+	Path string
+}
+
+type cacheRef struct {
+	spec  string
+	b3sum string
+}
+
+// NewSourceCache returns a SourceCache for the configured source cache location.
+func NewSourceCache(opts ...Option) (SourceCache, error) {
+	o := newOptions(opts)
+	return SourceCache{Path: o.resolveSourceCache()}, nil
+}
+
+// cacheRefs returns the specs referencing each file of the source cache by name, counting the
+// sources of the overrides of every architecture.
+func cacheRefs(specs []*Spec) (map[string][]cacheRef, error) {
+	refs := make(map[string][]cacheRef)
+	for _, spec := range specs {
+		sources, err := spec.everySource()
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range sources {
+			name := source.cacheName()
+			refs[name] = append(refs[name], cacheRef{spec: spec.Name, b3sum: source.B3Sum})
+		}
+	}
+	return refs, nil
+}
+
+func (c SourceCache) entries(specs []*Spec) ([]CacheEntry, error) {
+	files, err := os.ReadDir(c.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []CacheEntry{}, nil
+		}
+		return nil, fmt.Errorf("%w", err)
+	}
+	refs, err := cacheRefs(specs)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]CacheEntry, 0, len(files))
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		entry := CacheEntry{
+			Name:    file.Name(),
+			Path:    filepath.Join(c.Path, file.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Specs:   []string{},
+		}
+		for _, ref := range refs[file.Name()] {
+			entry.Specs = append(entry.Specs, ref.spec)
+		}
+		sort.Strings(entry.Specs)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// List returns every file in the source cache, along with which of the given specs reference it.
+func (c SourceCache) List(specs []*Spec) ([]CacheEntry, error) {
+	return c.entries(specs)
+}
+
+// Verify rehashes every file in the source cache. An error is returned if any file
+// does not match the b3sum expected by a spec which references it.
+func (c SourceCache) Verify(specs []*Spec) ([]CacheEntry, error) {
+	entries, err := c.entries(specs)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := cacheRefs(specs)
+	if err != nil {
+		return nil, err
+	}
+	var invalid []string
+	for i := range entries {
+		sum, err := computeB3SumFromFile(entries[i].Path)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].B3Sum = sum
+		entries[i].Valid = true
+		for _, ref := range refs[entries[i].Name] {
+			if ref.b3sum != sum {
+				entries[i].Valid = false
+			}
+		}
+		if !entries[i].Valid {
+			invalid = append(invalid, entries[i].Name)
+		}
+	}
+	if len(invalid) > 0 {
+		return entries, fmt.Errorf("%w: %s", errHash, strings.Join(invalid, ", "))
+	}
+	return entries, nil
+}
+
+// Prune removes files from the source cache which are not referenced by any of the
+// given specs, or which are older than maxAge. Either criteria is ignored when
+// specs is empty or maxAge is zero. When dryRun is true nothing is removed.
+// The entries selected for removal are returned.
+func (c SourceCache) Prune(specs []*Spec, maxAge time.Duration, dryRun bool) ([]CacheEntry, error) {
+	if len(specs) == 0 && maxAge <= 0 {
+		return nil, fmt.Errorf("%w", errPruneCriteria)
+	}
+	entries, err := c.entries(specs)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	pruned := make([]CacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		unreferenced := len(specs) > 0 && len(entry.Specs) == 0
+		expired := maxAge > 0 && entry.ModTime.Before(cutoff)
+		if !unreferenced && !expired {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(entry.Path); err != nil {
+				return pruned, fmt.Errorf("%w", err)
+			}
+		}
+		pruned = append(pruned, entry)
+	}
+	return pruned, nil
+}
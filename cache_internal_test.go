@@ -0,0 +1,146 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCache(t *testing.T) (SourceCache, []*Spec) {
+	t.Helper()
+	var buf bytes.Buffer
+	dir := t.TempDir()
+	spec, err := NewSpec("testdata/spec_local_file.yaml", WithLogger(Log{Output: &buf}), WithSourceCache(dir))
+	require.NoError(t, err)
+	require.Empty(t, spec.fetchSources(context.Background()))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orphan.tar.gz"), []byte("orphan"), 0o600))
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "orphan.tar.gz"), old, old))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o755))
+	return SourceCache{Path: dir}, []*Spec{spec}
+}
+
+func TestSourceCacheList(t *testing.T) {
+	t.Parallel()
+	t.Run("Should list files along with referencing specs", func(t *testing.T) {
+		t.Parallel()
+		cache, specs := setupCache(t)
+		entries, err := cache.List(specs)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "orphan.tar.gz", entries[0].Name)
+		assert.Empty(t, entries[0].Specs)
+		assert.Equal(t, "testarchive.tar.gz", entries[1].Name)
+		assert.Equal(t, []string{"musl"}, entries[1].Specs)
+	})
+	t.Run("Should count the sources of the overrides of other architectures as referenced", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		spec, err := NewSpec("testdata/spec_bump_overrides.yaml", WithArch("x86_64"), WithSourceCache(dir))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "testarchive.tar.gz"), []byte("riscv64"), 0o600))
+		entries, err := SourceCache{Path: dir}.List([]*Spec{spec})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, []string{"hello"}, entries[0].Specs)
+	})
+	t.Run("Should return nothing when the cache does not exist", func(t *testing.T) {
+		t.Parallel()
+		entries, err := SourceCache{Path: "testdata/no-such-cache"}.List(nil)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+	t.Run("Should fail when the cache is not a directory", func(t *testing.T) {
+		t.Parallel()
+		_, err := SourceCache{Path: "testdata/spec.yaml"}.List(nil)
+		require.Error(t, err)
+	})
+}
+
+func TestSourceCacheVerify(t *testing.T) {
+	t.Parallel()
+	t.Run("Should rehash every file", func(t *testing.T) {
+		t.Parallel()
+		cache, specs := setupCache(t)
+		entries, err := cache.Verify(specs)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.True(t, entries[1].Valid)
+		assert.Equal(t, fileB3Sum, entries[1].B3Sum)
+	})
+	t.Run("Should fail when a file does not match its spec", func(t *testing.T) {
+		t.Parallel()
+		cache, specs := setupCache(t)
+		require.NoError(t, os.WriteFile(filepath.Join(cache.Path, "testarchive.tar.gz"), []byte("corrupt"), 0o600))
+		entries, err := cache.Verify(specs)
+		require.EqualError(t, err, "b3sum mismatch: testarchive.tar.gz")
+		assert.False(t, entries[1].Valid)
+	})
+}
+
+func TestSourceCachePrune(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		description string
+		useSpecs    bool
+		maxAge      time.Duration
+		dryRun      bool
+		pruned      []string
+		remaining   int
+		errMsg      string
+	}{
+		{
+			description: "Should require some criteria",
+			errMsg:      "no prune criteria given",
+			remaining:   2,
+		},
+		{
+			description: "Should remove unreferenced files",
+			useSpecs:    true,
+			pruned:      []string{"orphan.tar.gz"},
+			remaining:   1,
+		},
+		{
+			description: "Should remove files older than the maximum age",
+			maxAge:      24 * time.Hour,
+			pruned:      []string{"orphan.tar.gz"},
+			remaining:   1,
+		},
+		{
+			description: "Should not remove anything during a dry run",
+			useSpecs:    true,
+			dryRun:      true,
+			pruned:      []string{"orphan.tar.gz"},
+			remaining:   2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			cache, specs := setupCache(t)
+			if !tc.useSpecs {
+				specs = nil
+			}
+			pruned, err := cache.Prune(specs, tc.maxAge, tc.dryRun)
+			if tc.errMsg != "" {
+				require.EqualError(t, err, tc.errMsg)
+			} else {
+				require.NoError(t, err)
+				names := make([]string, 0, len(pruned))
+				for _, entry := range pruned {
+					names = append(names, entry.Name)
+				}
+				assert.Equal(t, tc.pruned, names)
+			}
+			entries, err := cache.List(nil)
+			require.NoError(t, err)
+			assert.Len(t, entries, tc.remaining)
+		})
+	}
+}
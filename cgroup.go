@@ -0,0 +1,259 @@
+package mere
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cgroupMount   = "/sys/fs/cgroup"
+	cpuPeriod     = 100000
+	cgroupDirPerm = 0o755
+	// leafCgroup is the cgroup below its own into which mere moves when no parent is configured.
+	leafCgroup = "mere"
+)
+
+var (
+	errLimits      = errors.New("invalid limits")
+	errCgroup      = errors.New("cgroup v2 unavailable")
+	errCgroupInUse = errors.New("cgroup holds other processes")
+
+	// ownCgroupParent prepares the cgroup of mere as the parent of stage cgroups, once per process.
+	ownCgroupParent = sync.OnceValues(func() (string, error) {
+		return delegateCgroup(currentCgroup(), os.Getpid())
+	})
+)
+
+// Limits restricts the resources available to each build stage.
+type Limits struct {
+	// CPU is the number of CPUs a stage may use, such as 1.5.
+	CPU float64 `json:"cpu,omitempty" jsonschema:"minimum=0" jsonschema_description:"Number of CPUs"`
+	// Memory is the maximum memory of a stage in bytes, or with a K, M, G or T suffix.
+	Memory string `json:"memory,omitempty" jsonschema:"pattern=^[0-9]+[KMGT]?$,example=4G" jsonschema_description:"Maximum memory in bytes, or with a K, M, G or T suffix"`
+	// Pids is the maximum number of processes and threads in a stage.
+	Pids int64 `json:"pids,omitempty" jsonschema:"minimum=0" jsonschema_description:"Maximum number of processes and threads"`
+}
+
+// resourceLimits holds parsed Limits, zero values are unlimited.
+type resourceLimits struct {
+	cpu    float64
+	memory int64
+	pids   int64
+}
+
+func (l resourceLimits) isSet() bool {
+	return l.cpu > 0 || l.memory > 0 || l.pids > 0
+}
+
+func (l Limits) parse() (resourceLimits, error) {
+	memory, err := parseSize(l.Memory)
+	if err != nil {
+		return resourceLimits{}, fmt.Errorf("%w: memory: %w", errLimits, err)
+	}
+	return resourceLimits{cpu: l.CPU, memory: memory, pids: l.Pids}, nil
+}
+
+// parseSize parses a number of bytes with an optional binary K, M, G or T suffix.
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	shift := strings.Index("KMGT", size[len(size)-1:]) + 1
+	if shift > 0 {
+		size = size[:len(size)-1]
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	if n < 0 || n > math.MaxInt64>>(10*shift) {
+		return 0, fmt.Errorf("%w: size out of range", errLimits)
+	}
+	return n << (10 * shift), nil
+}
+
+// stricter returns the most restrictive combination of two sets of limits.
+func stricter(a, b resourceLimits) resourceLimits {
+	lowest := func(x, y float64) float64 {
+		if x <= 0 || (y > 0 && y < x) {
+			return y
+		}
+		return x
+	}
+	return resourceLimits{
+		cpu:    lowest(a.cpu, b.cpu),
+		memory: int64(lowest(float64(a.memory), float64(b.memory))),
+		pids:   int64(lowest(float64(a.pids), float64(b.pids))),
+	}
+}
+
+// stageUsage records the resources consumed by a stage.
+type stageUsage struct {
+	peakMemory int64
+	cpuTime    time.Duration
+}
+
+// cgroup is a transient cgroup v2 directory holding the processes of a single stage.
+type cgroup struct {
+	path string
+}
+
+// currentCgroup returns the cgroup of the current process.
+func currentCgroup() string {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return cgroupMount
+	}
+	// On a cgroup v2 only system the file contains a single line such as 0::/user.slice
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(cgroupMount, path)
+		}
+	}
+	return cgroupMount
+}
+
+// delegateCgroup prepares the cgroup own, which holds the process pid, as the parent of stage
+// cgroups. cgroup v2 does not enable controllers for the children of a cgroup which holds
+// processes, so the process moves into a leaf cgroup below own first. Other processes in own
+// cannot be moved on their behalf, in which case a delegated cgroupParent must be configured.
+func delegateCgroup(own string, pid int) (string, error) {
+	if _, err := os.Stat(filepath.Join(own, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("%w: %w", errCgroup, err)
+	}
+	leaf := filepath.Join(own, leafCgroup)
+	if err := os.Mkdir(leaf, cgroupDirPerm); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("%w: %w", errCgroup, err)
+	}
+	if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(own, "cgroup.procs"))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errCgroup, err)
+	}
+	if procs := strings.Fields(string(data)); len(procs) > 0 {
+		return "", fmt.Errorf("%w: %s holds processes %s, configure cgroupParent with a delegated cgroup",
+			errCgroupInUse, own, strings.Join(procs, " "))
+	}
+	return own, nil
+}
+
+// newCgroup creates a cgroup below parent and applies the given limits to it.
+// The controllers needed for the limits are enabled in the parent first. The parent
+// must be a cgroup v2 directory the current user may write to, such as one delegated
+// by systemd, and must not contain processes itself.
+func newCgroup(parent, pattern string, limits resourceLimits) (*cgroup, error) {
+	if _, err := os.Stat(filepath.Join(parent, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("%w: %w", errCgroup, err)
+	}
+	var controllers []string
+	if limits.cpu > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if limits.memory > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if limits.pids > 0 {
+		controllers = append(controllers, "+pids")
+	}
+	if len(controllers) > 0 {
+		if err := writeCgroupFile(parent, "cgroup.subtree_control", strings.Join(controllers, " ")); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp(parent, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCgroup, err)
+	}
+	cg := &cgroup{path: dir}
+	settings := map[string]string{}
+	if limits.cpu > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d %d", int64(math.Ceil(limits.cpu*cpuPeriod)), cpuPeriod)
+	}
+	if limits.memory > 0 {
+		settings["memory.max"] = strconv.FormatInt(limits.memory, 10)
+		settings["memory.swap.max"] = "0"
+	}
+	if limits.pids > 0 {
+		settings["pids.max"] = strconv.FormatInt(limits.pids, 10)
+	}
+	for _, file := range sortedKeys(settings) {
+		// Swap accounting is optional in the kernel, without it memory.max still applies.
+		if err := writeCgroupFile(dir, file, settings[file]); err != nil && file != "memory.swap.max" {
+			_ = cg.remove()
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), cgroupDirPerm); err != nil {
+		return fmt.Errorf("%w: %w", errCgroup, err)
+	}
+	return nil
+}
+
+// usage reads the peak memory and the CPU time consumed by the processes of the cgroup.
+// Values the kernel does not provide are left at zero.
+func (c *cgroup) usage() stageUsage {
+	var usage stageUsage
+	if data, err := os.ReadFile(filepath.Join(c.path, "memory.peak")); err == nil {
+		usage.peakMemory, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	f, err := os.Open(filepath.Join(c.path, "cpu.stat"))
+	if err != nil {
+		return usage
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "usage_usec "); ok {
+			usec, _ := strconv.ParseInt(value, 10, 64)
+			usage.cpuTime = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return usage
+}
+
+// remove kills any processes left in the cgroup and removes it.
+func (c *cgroup) remove() error {
+	// cgroup.kill requires Linux 5.14, older kernels leave the processes running.
+	if f, err := os.OpenFile(filepath.Join(c.path, "cgroup.kill"), os.O_WRONLY, 0); err == nil {
+		_, _ = f.WriteString("1")
+		f.Close()
+	}
+	var err error
+	// Removal fails with EBUSY until the killed processes have exited.
+	for range 50 {
+		if err = os.Remove(c.path); err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("%w", err)
+}
+
+// setupLimits combines the limits of the spec with those of the configuration file.
+func (s *Spec) setupLimits(config *Config) error {
+	specLimits, err := s.Limits.parse()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errValidate, err)
+	}
+	configLimits, err := config.Limits.parse()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	s.limits = stricter(specLimits, configLimits)
+	s.cgroupParent = config.CgroupParent
+	return nil
+}
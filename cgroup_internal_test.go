@@ -0,0 +1,190 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		size     string
+		expected int64
+		errMsg   string
+	}{
+		{size: "", expected: 0},
+		{size: "512", expected: 512},
+		{size: "4K", expected: 4 << 10},
+		{size: "16M", expected: 16 << 20},
+		{size: "2G", expected: 2 << 30},
+		{size: "1T", expected: 1 << 40},
+		{size: "lots", errMsg: `strconv.ParseInt: parsing "lots": invalid syntax`},
+		{size: "9999999999T", errMsg: "invalid limits: size out of range"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.size, func(t *testing.T) {
+			t.Parallel()
+			size, err := parseSize(tc.size)
+			if tc.errMsg != "" {
+				require.EqualError(t, err, tc.errMsg)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, size)
+			}
+		})
+	}
+}
+
+func Test_setupLimits(t *testing.T) {
+	t.Parallel()
+	t.Run("Should apply the stricter of the spec and config limits", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_limits.yaml", WithLogger(Log{Output: &buf}),
+			WithConfig(Config{Limits: Limits{Memory: "8G", Pids: 4096}, CgroupParent: "/sys/fs/cgroup/mere"}))
+		require.NoError(t, err)
+		assert.Equal(t, resourceLimits{cpu: 2, memory: 8 << 30, pids: 1024}, spec.limits)
+		assert.Equal(t, "/sys/fs/cgroup/mere", spec.cgroupParent)
+	})
+	t.Run("Should leave the parent to the cgroup of mere by default", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_limits.yaml", WithLogger(Log{Output: &buf}), WithConfig(Config{}))
+		require.NoError(t, err)
+		assert.Empty(t, spec.cgroupParent)
+	})
+	t.Run("Should fail on an invalid memory limit in the config", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		_, err := NewSpec("testdata/spec_with_limits.yaml", WithLogger(Log{Output: &buf}),
+			WithConfig(Config{Limits: Limits{Memory: "8X"}}))
+		require.EqualError(t, err, `config: invalid limits: memory: strconv.ParseInt: parsing "8X": invalid syntax`)
+	})
+}
+
+func Test_newCgroup(t *testing.T) {
+	t.Parallel()
+	t.Run("Should enable controllers and write limits below a cgroup v2 parent", func(t *testing.T) {
+		t.Parallel()
+		parent := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(parent, "cgroup.controllers"), []byte("cpu memory pids"), 0o644))
+		cg, err := newCgroup(parent, "mere-hello-build-", resourceLimits{cpu: 1.5, memory: 1 << 30, pids: 64})
+		require.NoError(t, err)
+		assert.Equal(t, parent, filepath.Dir(cg.path))
+		for file, expected := range map[string]string{
+			filepath.Join(parent, "cgroup.subtree_control"): "+cpu +memory +pids",
+			filepath.Join(cg.path, "cpu.max"):               "150000 100000",
+			filepath.Join(cg.path, "memory.max"):            "1073741824",
+			filepath.Join(cg.path, "memory.swap.max"):       "0",
+			filepath.Join(cg.path, "pids.max"):              "64",
+		} {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, expected, string(data), file)
+		}
+	})
+	t.Run("Should only enable the controllers of configured limits", func(t *testing.T) {
+		t.Parallel()
+		parent := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(parent, "cgroup.controllers"), []byte("cpu memory pids"), 0o644))
+		cg, err := newCgroup(parent, "mere-", resourceLimits{pids: 64})
+		require.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+		require.NoError(t, err)
+		assert.Equal(t, "+pids", string(data))
+		assert.NoFileExists(t, filepath.Join(cg.path, "memory.max"))
+	})
+	t.Run("Should fail when the parent is not a cgroup v2 directory", func(t *testing.T) {
+		t.Parallel()
+		_, err := newCgroup(t.TempDir(), "mere-", resourceLimits{pids: 64})
+		require.ErrorIs(t, err, errCgroup)
+	})
+}
+
+func Test_cgroupUsage(t *testing.T) {
+	t.Parallel()
+	t.Run("Should read peak memory and CPU time", func(t *testing.T) {
+		t.Parallel()
+		cg := &cgroup{path: t.TempDir()}
+		require.NoError(t, os.WriteFile(filepath.Join(cg.path, "memory.peak"), []byte("1048576\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(cg.path, "cpu.stat"),
+			[]byte("usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n"), 0o644))
+		assert.Equal(t, stageUsage{peakMemory: 1 << 20, cpuTime: 2500 * time.Millisecond}, cg.usage())
+	})
+	t.Run("Should leave values the kernel does not provide at zero", func(t *testing.T) {
+		t.Parallel()
+		cg := &cgroup{path: t.TempDir()}
+		assert.Equal(t, stageUsage{}, cg.usage())
+		require.NoError(t, cg.remove())
+		assert.NoDirExists(t, cg.path)
+	})
+}
+
+func Test_delegateCgroup(t *testing.T) {
+	t.Parallel()
+	// newOwn returns a fake cgroup v2 directory which holds the given processes after mere moved.
+	newOwn := func(t *testing.T, procs string) string {
+		t.Helper()
+		own := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(own, "cgroup.controllers"), []byte("cpu memory pids"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(own, "cgroup.procs"), []byte(procs), 0o644))
+		return own
+	}
+	t.Run("Should move the process into a leaf and use its own cgroup as the parent", func(t *testing.T) {
+		t.Parallel()
+		own := newOwn(t, "")
+		parent, err := delegateCgroup(own, 42)
+		require.NoError(t, err)
+		assert.Equal(t, own, parent)
+		data, err := os.ReadFile(filepath.Join(own, leafCgroup, "cgroup.procs"))
+		require.NoError(t, err)
+		assert.Equal(t, "42", string(data))
+	})
+	t.Run("Should fail when other processes remain in the cgroup", func(t *testing.T) {
+		t.Parallel()
+		_, err := delegateCgroup(newOwn(t, "7\n8\n"), 42)
+		require.ErrorIs(t, err, errCgroupInUse)
+		assert.ErrorContains(t, err, "holds processes 7 8, configure cgroupParent with a delegated cgroup")
+	})
+	t.Run("Should fail without cgroup v2", func(t *testing.T) {
+		t.Parallel()
+		_, err := delegateCgroup(t.TempDir(), 42)
+		require.ErrorIs(t, err, errCgroup)
+	})
+}
+
+func Test_executeStageLimits(t *testing.T) {
+	t.Parallel()
+	t.Run("Should fail the stage when the limits cannot be enforced", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_limits.yaml", WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf),
+			WithConfig(Config{CgroupParent: filepath.Join(t.TempDir(), "no-such-cgroup")}))
+		require.NoError(t, err)
+		require.NoError(t, spec.setupBuildSteps(context.Background(), tempd{}, slink{}))
+		defer spec.Cleanup()
+		err = spec.executeStage(context.Background(), Stage{Name: "build", Cmd: "touch ran"})
+		require.ErrorIs(t, err, errEnforceLimits)
+		require.ErrorIs(t, err, errCgroup)
+		assert.NoFileExists(t, filepath.Join(spec.buildContext, "ran"))
+		assert.Equal(t, -1, spec.Summary()[0].ExitCode)
+	})
+	t.Run("Should report usage without limits", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_no_sources.yaml", WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf),
+			WithConfig(Config{}))
+		require.NoError(t, err)
+		require.NoError(t, spec.setupBuildSteps(context.Background(), tempd{}, slink{}))
+		defer spec.Cleanup()
+		require.NoError(t, spec.executeStage(context.Background(), Stage{Name: "build", Cmd: "true"}))
+		assert.Positive(t, spec.Summary()[0].PeakMemory)
+	})
+}
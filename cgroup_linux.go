@@ -0,0 +1,24 @@
+package mere
+
+import (
+	"os"
+	"syscall"
+)
+
+const kilobyte = 1024
+
+// useCgroup starts the process directly inside the cgroup referred to by fd.
+func useCgroup(attr *syscall.SysProcAttr, fd int) {
+	attr.UseCgroupFD = true
+	attr.CgroupFD = fd
+}
+
+// processUsage returns the resources used by an exited process and its waited-for children.
+// Peak memory is that of the largest single process, as reported by getrusage.
+func processUsage(state *os.ProcessState) stageUsage {
+	usage := stageUsage{cpuTime: state.UserTime() + state.SystemTime()}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		usage.peakMemory = rusage.Maxrss * kilobyte
+	}
+	return usage
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package mere
+
+import (
+	"os"
+	"syscall"
+)
+
+// useCgroup does nothing, cgroups only exist on Linux.
+func useCgroup(*syscall.SysProcAttr, int) {}
+
+// processUsage returns the CPU time used by an exited process and its waited-for children.
+func processUsage(state *os.ProcessState) stageUsage {
+	return stageUsage{cpuTime: state.UserTime() + state.SystemTime()}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+func printSummary(results []mere.StageResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "STAGE\tEXIT\tDURATION\tCPU\tPEAK MEMORY\tLOG")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%.1fM\t%s\n",
+			result.Name, result.ExitCode, result.Duration.Truncate(time.Millisecond),
+			result.CPUTime.Truncate(time.Millisecond), float64(result.PeakMemory)/(1<<20), result.LogFile)
+	}
+}
+
+func printRepro(results []mere.ReproResult) {
+	for _, result := range results {
+		if result.Reproducible() {
+			fmt.Fprintf(os.Stdout, "%s: reproducible (%s)\n", result.Name, result.B3Sums[0])
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%s: differs (%s != %s)\n", result.Name, result.B3Sums[0], result.B3Sums[1])
+		if len(result.Differences) > 0 {
+			fmt.Fprintf(os.Stdout, "\t%s\n", strings.Join(result.Differences, "\n\t"))
+		}
+	}
+}
+
+type buildFlags struct {
+	logDir      string
+	output      string
+	checkRepro  bool
+	skipStages  []string
+	onlyStages  []string
+	keepWorkdir bool
+	resume      string
+	shell       bool
+	fakeroot    bool
+	force       bool
+	timeout     time.Duration
+	arch        string
+	// stageTimeouts holds durations such as 30m by stage name.
+	stageTimeouts map[string]string
+}
+
+// options converts the build flags into options for NewSpec.
+func (f *buildFlags) options() ([]mere.Option, error) {
+	var opts []mere.Option
+	if f.logDir != "" {
+		opts = append(opts, mere.WithLogDir(f.logDir))
+	}
+	if len(f.skipStages) > 0 {
+		opts = append(opts, mere.WithSkipStages(f.skipStages...))
+	}
+	if len(f.onlyStages) > 0 {
+		opts = append(opts, mere.WithOnlyStages(f.onlyStages...))
+	}
+	if f.resume != "" {
+		opts = append(opts, mere.WithResume(f.resume))
+	}
+	if f.shell {
+		opts = append(opts, mere.WithShellOnFailure())
+	}
+	if f.fakeroot {
+		opts = append(opts, mere.WithFakeroot())
+	}
+	if f.timeout > 0 {
+		opts = append(opts, mere.WithTimeout(f.timeout))
+	}
+	if f.arch != "" {
+		opts = append(opts, mere.WithArch(f.arch))
+	}
+	if len(f.stageTimeouts) > 0 {
+		timeouts := make(map[string]time.Duration, len(f.stageTimeouts))
+		for name, v := range f.stageTimeouts {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("--stage-timeout %s: %w", name, err)
+			}
+			timeouts[name] = d
+		}
+		opts = append(opts, mere.WithStageTimeouts(timeouts))
+	}
+	return opts, nil
+}
+
+// withDepVersions adds the repo and the versions of the packages in it to opts, such that the
+// build key changes with the versions of the build dependencies, as it does for build-all.
+func withDepVersions(opts []mere.Option) ([]mere.Option, error) {
+	repo, err := mere.NewRepo(opts...)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // already descriptive
+	}
+	index, err := repo.Index()
+	if err != nil {
+		return nil, err //nolint:wrapcheck // already descriptive
+	}
+	return append(opts, mere.WithRepo(repo.Path), mere.WithDepVersions(index.Versions())), nil
+}
+
+func runBuild(ctx context.Context, path string, opts []mere.Option, flags *buildFlags) error {
+	opts, err := withDepVersions(opts)
+	if err != nil {
+		return err
+	}
+	if flags.checkRepro {
+		results, err := mere.CheckReproducible(ctx, path, opts...)
+		printRepro(results)
+		return err //nolint:wrapcheck // already descriptive
+	}
+	spec, err := mere.NewSpec(path, opts...)
+	if err != nil {
+		return err //nolint:wrapcheck // already descriptive
+	}
+	cache, err := mere.NewBuildCache(opts...)
+	if err != nil {
+		return err //nolint:wrapcheck // already descriptive
+	}
+	if !flags.force {
+		artifacts, ok, err := cache.Get(spec, flags.output)
+		if err != nil {
+			return err //nolint:wrapcheck // already descriptive
+		}
+		if ok {
+			printArtifacts(artifacts)
+			return nil
+		}
+	}
+	if flags.keepWorkdir || flags.resume != "" {
+		defer func() { fmt.Fprintln(os.Stderr, "Working directory kept at", spec.WorkingDir()) }()
+	} else {
+		defer spec.Cleanup()
+	}
+	err = spec.BuildSteps(ctx)
+	printSummary(spec.Summary())
+	if err != nil {
+		return err //nolint:wrapcheck // already descriptive
+	}
+	artifacts, err := spec.CreatePackages(flags.output)
+	printArtifacts(artifacts)
+	if err != nil {
+		return err //nolint:wrapcheck // already descriptive
+	}
+	return cache.Put(spec, artifacts) //nolint:wrapcheck // already descriptive
+}
+
+func printArtifacts(artifacts []mere.Artifact) {
+	for _, artifact := range artifacts {
+		fmt.Fprintf(os.Stdout, "%s  %s\n", artifact.B3Sum, artifact.Path)
+	}
+}
+
+func newBuildCmd(global *globalFlags) *cobra.Command {
+	flags := new(buildFlags)
+	cmd := &cobra.Command{
+		Use:   "build <spec>",
+		Short: "Build the packages defined in a spec file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := global.options()
+			if err != nil {
+				return err
+			}
+			buildOpts, err := flags.options()
+			if err != nil {
+				return err
+			}
+			return runBuild(cmd.Context(), args[0], append(opts, buildOpts...), flags)
+		},
+	}
+	cmd.Flags().StringVar(&flags.logDir, "log-dir", "", "directory in which to keep stage logs after the build")
+	cmd.Flags().StringVarP(&flags.output, "output", "o", ".", "directory in which to write package archives")
+	cmd.Flags().BoolVar(&flags.checkRepro, "check-repro", false,
+		"build twice in different working directories and compare the package archives")
+	cmd.Flags().StringSliceVar(&flags.skipStages, "skip-stage", nil, "stages to skip, may be repeated")
+	cmd.Flags().StringSliceVar(&flags.onlyStages, "only-stage", nil, "only execute these stages, may be repeated")
+	cmd.Flags().BoolVar(&flags.keepWorkdir, "keep-workdir", false, "keep the working directory after the build")
+	cmd.Flags().StringVar(&flags.resume, "resume", "",
+		"reuse the working directory of a previous build instead of extracting sources again")
+	cmd.Flags().BoolVar(&flags.shell, "shell-on-failure", false,
+		"start an interactive shell in the build environment when a stage fails")
+	cmd.Flags().BoolVar(&flags.fakeroot, "fakeroot", false,
+		"run stages in a user namespace as root, so they may chown files to root or, with subordinate ids, to other users")
+	cmd.Flags().BoolVar(&flags.force, "force", false, "build even when the packages of an identical build are cached")
+	cmd.Flags().DurationVar(&flags.timeout, "timeout", 0, "maximum duration of the build, overriding the spec")
+	cmd.Flags().StringToStringVar(&flags.stageTimeouts, "stage-timeout", nil,
+		"maximum duration of a stage as name=duration, such as build=2h, overriding the spec, may be repeated")
+	cmd.Flags().StringVar(&flags.arch, "arch", "",
+		"architecture to build for, selecting the overrides of the spec, by default that of the host")
+	return cmd
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+// buildAllFlags holds the flags of the build-all command.
+type buildAllFlags struct {
+	jobs   int
+	force  bool
+	repo   string
+	logDir string
+	arch   string
+}
+
+// options converts the build-all flags into options for BuildAll.
+func (f *buildAllFlags) options() []mere.Option {
+	opts := []mere.Option{mere.WithParallel(f.jobs)}
+	if f.force {
+		opts = append(opts, mere.WithForce())
+	}
+	if f.repo != "" {
+		opts = append(opts, mere.WithRepo(f.repo))
+	}
+	if f.logDir != "" {
+		opts = append(opts, mere.WithLogDir(f.logDir))
+	}
+	if f.arch != "" {
+		opts = append(opts, mere.WithArch(f.arch))
+	}
+	return opts
+}
+
+func printBuildResults(results []mere.BuildResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "SPEC\tSTATUS\tPATH\tERROR")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Spec, result.Status, result.Path, result.Error)
+	}
+}
+
+func newBuildAllCmd(global *globalFlags) *cobra.Command {
+	flags := new(buildAllFlags)
+	cmd := &cobra.Command{
+		Use:   "build-all <dir>",
+		Short: "Build every spec below a directory in dependency order, adding the packages to the repo",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := global.options()
+			if err != nil {
+				return err
+			}
+			results, err := mere.BuildAll(cmd.Context(), args[0], append(opts, flags.options()...)...)
+			printBuildResults(results)
+			return err //nolint:wrapcheck // already descriptive
+		},
+	}
+	cmd.Flags().IntVarP(&flags.jobs, "jobs", "j", 1, "number of specs to build at once")
+	cmd.Flags().BoolVar(&flags.force, "force", false, "build even when the packages of an identical build are cached")
+	cmd.Flags().StringVar(&flags.repo, "repo", "", "local repo to add packages to and install build dependencies from")
+	cmd.Flags().StringVar(&flags.logDir, "log-dir", "", "directory in which to keep stage logs after the builds")
+	cmd.Flags().StringVar(&flags.arch, "arch", "",
+		"architecture to build for, selecting the overrides of the specs and skipping specs which do not support it")
+	return cmd
+}
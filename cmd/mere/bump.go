@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+func newBumpCmd(global *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "bump <spec> <version>",
+		Short: "Update a spec to a new version and the b3sums of its sources",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := global.options()
+			if err != nil {
+				return err
+			}
+			result, err := mere.Bump(cmd.Context(), args[0], args[1], opts...)
+			if err != nil {
+				return err //nolint:wrapcheck // already descriptive
+			}
+			fmt.Printf("%s: %s -> %s\n", result.Path, result.OldVersion, result.Version)
+			for _, source := range result.Sources {
+				fmt.Printf("  %s %s\n", source.B3Sum, source.URL)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+const hoursPerDay = 24
+
+func newCacheCmd(flags *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the source cache",
+	}
+	cmd.AddCommand(newCacheListCmd(flags), newCacheVerifyCmd(flags), newCachePruneCmd(flags))
+	return cmd
+}
+
+func printCacheEntries(entries []mere.CacheEntry, verified bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	if verified {
+		fmt.Fprintln(w, "NAME\tSTATUS\tB3SUM\tSPECS")
+	} else {
+		fmt.Fprintln(w, "NAME\tSIZE\tAGE\tSPECS")
+	}
+	for _, entry := range entries {
+		specs := strings.Join(entry.Specs, ",")
+		if verified {
+			status := "ok"
+			if !entry.Valid {
+				status = "MISMATCH"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Name, status, entry.B3Sum, specs)
+			continue
+		}
+		age := time.Since(entry.ModTime).Truncate(time.Second)
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", entry.Name, entry.Size, age, specs)
+	}
+}
+
+// loadCache returns the configured source cache along with the given specs.
+func loadCache(flags *globalFlags, paths []string) (mere.SourceCache, []*mere.Spec, error) {
+	opts, err := flags.options()
+	if err != nil {
+		return mere.SourceCache{}, nil, err
+	}
+	cache, err := mere.NewSourceCache(opts...)
+	if err != nil {
+		return cache, nil, err //nolint:wrapcheck // already descriptive
+	}
+	specs, err := loadSpecs(paths, opts)
+	return cache, specs, err
+}
+
+func newCacheListCmd(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [spec...]",
+		Short: "List files in the source cache and which of the given specs reference them",
+		RunE: func(_ *cobra.Command, args []string) error {
+			cache, specs, err := loadCache(flags, args)
+			if err != nil {
+				return err
+			}
+			entries, err := cache.List(specs)
+			if err != nil {
+				return err //nolint:wrapcheck // already descriptive
+			}
+			printCacheEntries(entries, false)
+			return nil
+		},
+	}
+}
+
+func newCacheVerifyCmd(flags *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify [spec...]",
+		Short: "Rehash every file in the source cache, checking against the given specs",
+		RunE: func(_ *cobra.Command, args []string) error {
+			cache, specs, err := loadCache(flags, args)
+			if err != nil {
+				return err
+			}
+			entries, err := cache.Verify(specs)
+			printCacheEntries(entries, true)
+			return err //nolint:wrapcheck // already descriptive
+		},
+	}
+}
+
+func newCachePruneCmd(flags *globalFlags) *cobra.Command {
+	var days int
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "prune [spec...]",
+		Short: "Remove files not referenced by the given specs or older than a number of days",
+		RunE: func(_ *cobra.Command, args []string) error {
+			cache, specs, err := loadCache(flags, args)
+			if err != nil {
+				return err
+			}
+			maxAge := time.Duration(days) * hoursPerDay * time.Hour
+			pruned, err := cache.Prune(specs, maxAge, dryRun)
+			action := "removed"
+			if dryRun {
+				action = "would remove"
+			}
+			for _, entry := range pruned {
+				fmt.Fprintln(os.Stdout, action, entry.Path)
+			}
+			return err //nolint:wrapcheck // already descriptive
+		},
+	}
+	cmd.Flags().IntVar(&days, "older-than", 0, "remove files last modified more than this many days ago")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only report what would be removed")
+	return cmd
+}
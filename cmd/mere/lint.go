@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+var errLint = errors.New("problems found")
+
+// specPaths expands the given directories into the spec files below them.
+func specPaths(paths []string) ([]string, error) {
+	expanded := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			tree, err := mere.SpecPaths(path)
+			if err != nil {
+				return nil, err //nolint:wrapcheck // SpecPaths errors already describe the failure
+			}
+			expanded = append(expanded, tree...)
+			continue
+		}
+		expanded = append(expanded, path)
+	}
+	return expanded, nil
+}
+
+func newLintCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "lint <spec|dir>...",
+		Short: "Check specs for common problems",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			paths, err := specPaths(args)
+			if err != nil {
+				return err
+			}
+			diagnostics := []mere.Diagnostic{}
+			for _, path := range paths {
+				found, err := mere.Lint(path)
+				if err != nil {
+					return err //nolint:wrapcheck // already descriptive
+				}
+				diagnostics = append(diagnostics, found...)
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(diagnostics); err != nil {
+					return err //nolint:wrapcheck // already descriptive
+				}
+			} else {
+				for _, diagnostic := range diagnostics {
+					fmt.Println(diagnostic)
+				}
+			}
+			if len(diagnostics) > 0 {
+				return fmt.Errorf("%w: %d", errLint, len(diagnostics))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the diagnostics as JSON")
+	return cmd
+}
@@ -0,0 +1,121 @@
+// Command mere is the command line interface to the mere package manager.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+var errLogFormat = errors.New("unsupported log format")
+
+// globalFlags holds the flags shared by every command.
+type globalFlags struct {
+	config      string
+	sourceCache string
+	buildCache  string
+	debug       bool
+	logFormat   string
+}
+
+// logger returns the Logger selected by the --log-format flag.
+func (g *globalFlags) logger() (mere.Logger, error) {
+	switch g.logFormat {
+	case "plain":
+		return mere.Log{Output: os.Stderr, EnableDebug: g.debug}, nil
+	case "json":
+		return mere.NewJSONLog(os.Stderr, g.debug), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errLogFormat, g.logFormat)
+	}
+}
+
+// options converts the global flags into options for the mere constructors.
+func (g *globalFlags) options() ([]mere.Option, error) {
+	config, err := mere.LoadConfig(g.config)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // LoadConfig errors already describe the failure
+	}
+	log, err := g.logger()
+	if err != nil {
+		return nil, err
+	}
+	opts := []mere.Option{mere.WithConfig(config), mere.WithLogger(log)}
+	if g.sourceCache != "" {
+		opts = append(opts, mere.WithSourceCache(g.sourceCache))
+	}
+	if g.buildCache != "" {
+		opts = append(opts, mere.WithBuildCache(g.buildCache))
+	}
+	return opts, nil
+}
+
+func newRootCmd() *cobra.Command {
+	flags := new(globalFlags)
+	root := &cobra.Command{
+		Use:           "mere",
+		Short:         "An experimental package manager",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&flags.config, "config", mere.ConfigPath(), "path to the mere configuration file")
+	root.PersistentFlags().StringVar(&flags.sourceCache, "source-cache", "",
+		"directory in which fetched sources are stored")
+	root.PersistentFlags().StringVar(&flags.buildCache, "build-cache", "",
+		"directory in which the packages of previous builds are kept")
+	root.PersistentFlags().BoolVar(&flags.debug, "debug", false, "enable debug output")
+	root.PersistentFlags().StringVar(&flags.logFormat, "log-format", "plain", "format of log messages, plain or json")
+	root.AddCommand(newBuildCmd(flags), newBuildAllCmd(flags), newCacheCmd(flags), newOutdatedCmd(flags),
+		newCheckUpdatesCmd(flags), newBumpCmd(flags), newNewCmd(flags),
+		newLintCmd(), newSchemaCmd())
+	return root
+}
+
+// printSkipped reports the spec files of a tree which were skipped, as they do not support
+// the target architecture.
+func printSkipped(skipped []mere.SkippedSpec) {
+	for _, spec := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s: %s\n", spec.Path, spec.Reason)
+	}
+}
+
+// loadSpecs constructs a Spec for each of the given spec files, and for every spec file
+// below the given directories. Spec files below directories which do not support the target
+// architecture are skipped.
+func loadSpecs(paths []string, opts []mere.Option) ([]*mere.Spec, error) {
+	specs := make([]*mere.Spec, 0, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			tree, skipped, err := mere.LoadSpecs(path, opts...)
+			if err != nil {
+				return nil, err //nolint:wrapcheck // LoadSpecs errors already describe the failure
+			}
+			printSkipped(skipped)
+			specs = append(specs, tree...)
+			continue
+		}
+		spec, err := mere.NewSpec(path, opts...)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // NewSpec errors already describe the failure
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func main() {
+	// Interrupting mere cancels the context, which aborts any build and cleans up after it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := newRootCmd().ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
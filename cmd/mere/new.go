@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+const specPerm = 0o644
+
+func newNewCmd(global *globalFlags) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "new <url>",
+		Short: "Write a spec for the source archive at a URL",
+		Long: "Download a source archive, compute its b3sum and detect its build system, then write a spec\n" +
+			"named after it, such as hello.yaml. Existing files are not overwritten.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := global.options()
+			if err != nil {
+				return err
+			}
+			skeleton, err := mere.NewSkeleton(cmd.Context(), args[0], opts...)
+			if err != nil {
+				return err //nolint:wrapcheck // already descriptive
+			}
+			if output == "-" {
+				_, err := os.Stdout.Write(skeleton.YAML())
+				return err //nolint:wrapcheck // writing to stdout
+			}
+			if output == "" {
+				output = skeleton.Name + ".yaml"
+			}
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, specPerm)
+			if err != nil {
+				return err //nolint:wrapcheck // the path is part of the error
+			}
+			if _, err := f.Write(skeleton.YAML()); err != nil {
+				f.Close()
+				return err //nolint:wrapcheck // the path is part of the error
+			}
+			if err := f.Close(); err != nil {
+				return err //nolint:wrapcheck // the path is part of the error
+			}
+			fmt.Println("Wrote " + output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write the spec to, - for standard output")
+	return cmd
+}
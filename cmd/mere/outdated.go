@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+func printOutdated(results []mere.OutdatedSpec) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "SPEC\tVERSION\tREPO\tREASON\tDEPS")
+	for _, result := range results {
+		repoVersion := result.RepoVersion
+		if repoVersion == "" {
+			repoVersion = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			result.Spec, result.Version, repoVersion, result.Reason, strings.Join(result.Deps, ","))
+	}
+}
+
+func newOutdatedCmd(global *globalFlags) *cobra.Command {
+	var (
+		repo   string
+		asJSON bool
+	)
+	cmd := &cobra.Command{
+		Use:   "outdated <dir>",
+		Short: "List the specs below a directory which are newer than the repo or need rebuilding",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := global.options()
+			if err != nil {
+				return err
+			}
+			if repo != "" {
+				opts = append(opts, mere.WithRepo(repo))
+			}
+			specs, skipped, err := mere.LoadSpecs(args[0], opts...)
+			if err != nil {
+				return err //nolint:wrapcheck // already descriptive
+			}
+			printSkipped(skipped)
+			r, err := mere.NewRepo(opts...)
+			if err != nil {
+				return err //nolint:wrapcheck // already descriptive
+			}
+			index, err := r.Index()
+			if err != nil {
+				return err //nolint:wrapcheck // already descriptive
+			}
+			results := mere.Outdated(specs, index)
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(results) //nolint:wrapcheck // already descriptive
+			}
+			printOutdated(results)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&repo, "repo", "", "local repo whose index the specs are compared with")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the results as JSON")
+	return cmd
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+func newSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "schema [" + strings.Join(mere.SchemaNames(), "|") + "]",
+		Short:     "Print the JSON Schema of spec files, package manifests or repo indexes",
+		Long:      "Print the JSON Schema of spec files, package manifests or repo indexes, spec files by default.",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: mere.SchemaNames(),
+		RunE: func(_ *cobra.Command, args []string) error {
+			name := "spec"
+			if len(args) > 0 {
+				name = args[0]
+			}
+			data, err := mere.Schema(name)
+			if err != nil {
+				return err //nolint:wrapcheck // already descriptive
+			}
+			if _, err := os.Stdout.Write(data); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+			return nil
+		},
+	}
+}
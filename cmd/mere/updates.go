@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jhuntwork/mere"
+	"github.com/spf13/cobra"
+)
+
+var errUpdates = errors.New("unable to check the upstream of some specs")
+
+func printUpdates(results []mere.UpdateResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "SPEC\tVERSION\tUPSTREAM\tSTATUS")
+	for _, result := range results {
+		status := "current"
+		switch {
+		case result.Error != "":
+			status = "error: " + result.Error
+		case result.Newer:
+			status = "update available"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Spec, result.Version, result.Upstream, status)
+	}
+}
+
+func newCheckUpdatesCmd(global *globalFlags) *cobra.Command {
+	var onlyNewer bool
+	cmd := &cobra.Command{
+		Use:   "check-updates <spec|dir>...",
+		Short: "Report specs whose upstream has a newer version",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := global.options()
+			if err != nil {
+				return err
+			}
+			specs, err := loadSpecs(args, opts)
+			if err != nil {
+				return err
+			}
+			results := mere.CheckUpdates(cmd.Context(), specs)
+			shown := make([]mere.UpdateResult, 0, len(results))
+			failed := false
+			for _, result := range results {
+				failed = failed || result.Error != ""
+				if !onlyNewer || result.Newer {
+					shown = append(shown, result)
+				}
+			}
+			printUpdates(shown)
+			if failed {
+				return errUpdates
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&onlyNewer, "newer", false, "only list specs with a newer upstream version")
+	return cmd
+}
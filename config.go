@@ -0,0 +1,65 @@
+package mere
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	defaultConfigPath = "/etc/mere/config.yaml"
+	envConfig         = "MERE_CONFIG"
+	envSourceCache    = "MERE_SOURCE_CACHE"
+	envBuildCache     = "MERE_BUILD_CACHE"
+	envRepo           = "MERE_REPO"
+)
+
+// Config holds the settings which may be provided by the mere configuration file.
+type Config struct {
+	// SourceCache is the directory in which fetched sources are stored.
+	SourceCache string `json:"sourceCache,omitempty"`
+	// BuildCache is the directory in which the packages of previous builds are kept.
+	BuildCache string `json:"buildCache,omitempty"`
+	// Repo is the local repo into which build-all adds packages, and from which build
+	// dependencies are installed.
+	Repo string `json:"repo,omitempty"`
+	// LogDir is a directory in which stage logs are kept after the build.
+	LogDir string `json:"logDir,omitempty"`
+	// Profile holds the global build profile, such as compiler flags and the number of jobs.
+	Profile BuildProfile `json:"profile,omitempty"`
+	// Limits restricts the resources of every build stage. When a spec also sets limits,
+	// the stricter value of each applies.
+	Limits Limits `json:"limits,omitempty"`
+	// CgroupParent is the cgroup v2 directory in which the cgroups of stages are created, such
+	// as one delegated by systemd. It must not hold processes itself. When unset, mere moves into
+	// a leaf cgroup below its own, which then becomes the parent, provided that no other processes
+	// share it.
+	CgroupParent string `json:"cgroupParent,omitempty"`
+}
+
+// ConfigPath returns the location of the mere configuration file, which is
+// taken from $MERE_CONFIG when set.
+func ConfigPath() string {
+	if path := os.Getenv(envConfig); path != "" {
+		return path
+	}
+	return defaultConfigPath
+}
+
+// LoadConfig reads the configuration file at the given path. A missing file is
+// not an error, it results in an empty Config.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, fmt.Errorf("%w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,65 @@
+package mere
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		description string
+		path        string
+		expected    Config
+		errMsg      string
+	}{
+		{
+			description: "Should read settings from the file",
+			path:        "testdata/config.yaml",
+			expected: Config{
+				SourceCache: "/var/cache/mere/src",
+				Profile:     BuildProfile{CFlags: "-O2", LDFlags: "-Wl,--as-needed", Jobs: 4},
+				Limits:      Limits{Memory: "8G", Pids: 512},
+			},
+		},
+		{
+			description: "Should return an empty config if the file does not exist",
+			path:        "testdata/no-such-config.yaml",
+		},
+		{
+			description: "Should fail when the file contains invalid YAML",
+			path:        "testdata/bad_yaml.txt",
+			errMsg:      "testdata/bad_yaml.txt: error converting YAML to JSON: yaml: line 3: could not find expected ':'",
+		},
+		{
+			description: "Should fail when the file cannot be read",
+			path:        "/dev/null/config.yaml",
+			errMsg:      "open /dev/null/config.yaml: not a directory",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			config, err := LoadConfig(tc.path)
+			if tc.errMsg != "" {
+				require.EqualError(t, err, tc.errMsg)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, config)
+			}
+		})
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	t.Run("Should use the default location", func(t *testing.T) {
+		t.Setenv(envConfig, "")
+		assert.Equal(t, defaultConfigPath, ConfigPath())
+	})
+	t.Run("Should prefer the environment", func(t *testing.T) {
+		t.Setenv(envConfig, "testdata/config.yaml")
+		assert.Equal(t, "testdata/config.yaml", ConfigPath())
+	})
+}
@@ -0,0 +1,125 @@
+package mere
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPath = "/usr/local/bin:/usr/bin:/bin:/usr/local/sbin:/usr/sbin:/sbin"
+	mereName    = "MERE_NAME"
+	mereVersion = "MERE_VERSION"
+	mereRelease = "MERE_RELEASE"
+	mereJobs    = "MERE_JOBS"
+	mereArch    = "MERE_ARCH"
+	dateEpoch   = "SOURCE_DATE_EPOCH"
+)
+
+// BuildProfile holds global settings for the compilers and tools used during builds.
+type BuildProfile struct {
+	CFlags   string `json:"cflags,omitempty"`
+	CXXFlags string `json:"cxxflags,omitempty"`
+	LDFlags  string `json:"ldflags,omitempty"`
+	// Jobs is the number of parallel jobs, defaulting to the number of CPUs.
+	Jobs int `json:"jobs,omitempty"`
+	// Prefix is the installation prefix, defaulting to /usr.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+func (p BuildProfile) jobs() int {
+	if p.Jobs > 0 {
+		return p.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+func (p BuildProfile) prefix() string {
+	return valueOr(p.Prefix, defaultPrefix)
+}
+
+// buildEnv returns the environment used by every build stage, sorted by name.
+//
+// The base environment contains:
+//
+//	PATH          a fixed list of standard system directories
+//	HOME          the working directory
+//	SHELL         /bin/sh
+//	LC_ALL        C
+//	TZ            UTC
+//	CFLAGS, CXXFLAGS, LDFLAGS
+//	              from the build profile, when set
+//	MAKEFLAGS     -j followed by the number of jobs
+//	MERE_JOBS     the number of jobs from the build profile
+//
+// Variables from the spec's env map are merged over the base environment, followed by
+// the given stage variables and those given with WithEnv. Finally MERE_NAME, MERE_VERSION, MERE_RELEASE, MERE_ARCH,
+// MERE_PKGDIR, MERE_SRCDIR and SOURCE_DATE_EPOCH are set, and cannot be overridden. When a repo is configured,
+// MERE_DEPSDIR is set to the directory holding the installed build dependencies, and their
+// usr/bin and bin directories are prepended to PATH.
+func (s *Spec) buildEnv(stageEnv map[string]string) []string {
+	jobs := strconv.Itoa(s.profile.jobs())
+	env := map[string]string{
+		"PATH":      defaultPath,
+		"HOME":      s.workingDir,
+		"SHELL":     "/bin/sh",
+		"LC_ALL":    "C",
+		"TZ":        "UTC",
+		"MAKEFLAGS": "-j" + jobs,
+		mereJobs:    jobs,
+	}
+	for key, value := range map[string]string{
+		"CFLAGS":   s.profile.CFlags,
+		"CXXFLAGS": s.profile.CXXFlags,
+		"LDFLAGS":  s.profile.LDFlags,
+	} {
+		if value != "" {
+			env[key] = value
+		}
+	}
+	for _, vars := range []map[string]string{s.Env, stageEnv, s.env} {
+		for key, value := range vars {
+			env[key] = value
+		}
+	}
+	env[mereName] = s.Name
+	env[mereVersion] = s.Version
+	env[mereRelease] = strconv.FormatInt(s.Release, 10)
+	env[mereArch] = s.Arch()
+	env[merePkgdir] = fmt.Sprintf("%s/%s", s.workingDir, pkg)
+	env[mereSrcdir] = fmt.Sprintf("%s/%s", s.workingDir, src)
+	env[dateEpoch] = strconv.FormatInt(s.sourceDateEpoch, 10)
+	if s.repo != "" {
+		deps := fmt.Sprintf("%s/%s", s.workingDir, depsDir)
+		env[mereDepsdir] = deps
+		env["PATH"] = fmt.Sprintf("%s/usr/bin:%s/bin:%s", deps, deps, env["PATH"])
+	}
+
+	vars := make([]string, 0, len(env))
+	for _, key := range sortedKeys(env) {
+		vars = append(vars, key+"="+env[key])
+	}
+	return vars
+}
+
+// resolveSourceDateEpoch determines the SOURCE_DATE_EPOCH of the build. It is taken from the
+// spec's sourceDateEpoch if set, otherwise the newest entry in the first source archive, or zero.
+func (s *Spec) resolveSourceDateEpoch() int64 {
+	if s.SourceDateEpoch > 0 {
+		return s.SourceDateEpoch
+	}
+	if len(s.Sources) > 0 {
+		newest, err := newestModTime(s.Sources[0].savePath)
+		if err == nil {
+			return newest.Unix()
+		}
+		s.log.Debug("Unable to derive SOURCE_DATE_EPOCH from sources: " + err.Error())
+	}
+	return 0
+}
+
+// logEnv reports the final build environment at debug level.
+func (s *Spec) logEnv() {
+	s.log.Debug("Build environment:\n\t" + strings.Join(s.buildEnv(nil), "\n\t"))
+}
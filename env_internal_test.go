@@ -0,0 +1,69 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_buildEnv(t *testing.T) {
+	t.Parallel()
+	t.Run("Should provide the base environment and build profile", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		config, err := LoadConfig("testdata/config.yaml")
+		require.NoError(t, err)
+		spec, err := NewSpec("testdata/spec_no_sources.yaml", WithLogger(Log{Output: &buf}), WithConfig(config),
+			WithArch("riscv64"))
+		require.NoError(t, err)
+		spec.workingDir = "/tmp/work"
+		assert.Equal(t, []string{
+			"CFLAGS=-O2",
+			"HOME=/tmp/work",
+			"LC_ALL=C",
+			"LDFLAGS=-Wl,--as-needed",
+			"MAKEFLAGS=-j4",
+			"MERE_ARCH=riscv64",
+			"MERE_JOBS=4",
+			"MERE_NAME=musl",
+			"MERE_PKGDIR=/tmp/work/package",
+			"MERE_RELEASE=1",
+			"MERE_SRCDIR=/tmp/work/source",
+			"MERE_VERSION=1.1.23",
+			"PATH=" + defaultPath,
+			"SHELL=/bin/sh",
+			"SOURCE_DATE_EPOCH=0",
+			"TZ=UTC",
+		}, spec.buildEnv(nil))
+	})
+	t.Run("Should merge the spec env and WithEnv over the base environment", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_env.yaml", WithLogger(Log{Output: &buf}), WithConfig(Config{}),
+			WithEnv(map[string]string{"PATH": "/usr/bin", "MERE_PKGDIR": "/"}))
+		require.NoError(t, err)
+		env := spec.buildEnv(nil)
+		assert.Contains(t, env, "CFLAGS=-O2 -pipe")
+		assert.Contains(t, env, "MUSL_VERSION=1.1.23")
+		assert.Contains(t, env, "PATH=/usr/bin")
+		assert.Contains(t, env, "MERE_NAME=musl")
+		assert.Contains(t, env, "MERE_PKGDIR=/package")
+		assert.Contains(t, env, "MAKEFLAGS=-j"+strconv.Itoa(runtime.NumCPU()))
+	})
+	t.Run("Should provide the environment to stages and log it in debug mode", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_env.yaml",
+			WithLogger(Log{Output: &buf, EnableDebug: true}), WithStageOutput(&buf, &buf), WithConfig(Config{}))
+		require.NoError(t, err)
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "Build environment:\n\tCFLAGS=-O2 -pipe\n")
+	})
+}
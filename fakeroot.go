@@ -0,0 +1,80 @@
+package mere
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+var errFakeroot = errors.New("fakeroot error")
+
+const (
+	subuidFile = "/etc/subuid"
+	subgidFile = "/etc/subgid"
+)
+
+// idMap maps size ids starting at host outside of a user namespace to the ids starting at
+// container inside of it.
+type idMap struct {
+	container int
+	host      int
+	size      int
+}
+
+// subordinateIDs returns the first range of subordinate ids which file, in the format of
+// /etc/subuid, assigns to the user with the given name or id.
+func subordinateIDs(file, name string, id int) (idMap, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return idMap{}, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 3 || (fields[0] != name && fields[0] != strconv.Itoa(id)) {
+			continue
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil || size <= 0 {
+			continue
+		}
+		return idMap{container: 1, host: start, size: size}, true
+	}
+	return idMap{}, false
+}
+
+// fakerootIDMaps maps id to root in a fakeroot build, followed by the subordinate ids assigned
+// to the user in file, such that stages may also give files to other owners.
+func fakerootIDMaps(file, name string, id int) []idMap {
+	maps := []idMap{{container: 0, host: id, size: 1}}
+	if sub, ok := subordinateIDs(file, name, id); ok {
+		maps = append(maps, sub)
+	}
+	return maps
+}
+
+// setupFakerootIDs sets the uid and gid maps of a fakeroot build for the current user.
+func (s *Spec) setupFakerootIDs() {
+	var name string
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	s.uidMap = fakerootIDMaps(subuidFile, name, s.buildUID)
+	s.gidMap = fakerootIDMaps(subgidFile, name, s.buildGID)
+}
+
+// containerID returns the id inside of the user namespace of a host id. Ids which are not
+// mapped are returned unchanged.
+func containerID(maps []idMap, id int) int {
+	for _, m := range maps {
+		if id >= m.host && id < m.host+m.size {
+			return m.container + id - m.host
+		}
+	}
+	return id
+}
@@ -0,0 +1,152 @@
+package mere
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_fakeroot(t *testing.T) {
+	t.Parallel()
+	t.Run("Should run stages in a user namespace mapping the build user to root", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_fakeroot.yaml",
+			WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf), WithFakeroot())
+		require.NoError(t, err)
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		if err != nil && strings.Contains(err.Error(), "operation not permitted") {
+			t.Skip("user namespaces are not permitted: " + err.Error())
+		}
+		require.NoError(t, err, buf.String())
+		data, err := os.ReadFile(filepath.Join(spec.workingDir, pkg, "uid_map"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"0", fmt.Sprint(os.Getuid()), "1"}, strings.Fields(string(data)))
+
+		artifacts, err := spec.CreatePackages(t.TempDir())
+		require.NoError(t, err)
+		var hello ManifestFile
+		for _, file := range artifacts[0].Manifest.Files {
+			if file.Path == "bin/hello" {
+				hello = file
+			}
+		}
+		assert.Equal(t, 0, hello.UID)
+		assert.Equal(t, 0, hello.GID)
+		assert.Equal(t, uint32(0o4755), hello.Mode)
+	})
+}
+
+func Test_fakerootOwners(t *testing.T) {
+	t.Parallel()
+	t.Run("Should record owners other than root through subordinate ids", func(t *testing.T) {
+		t.Parallel()
+		if os.Geteuid() != 0 {
+			t.Skip("only root maps subordinate ids without newuidmap and newgidmap")
+		}
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_fakeroot_owners.yaml",
+			WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf), WithFakeroot())
+		require.NoError(t, err)
+		spec.uidMap = []idMap{{container: 0, host: 0, size: 1}, {container: 1, host: 200000, size: 65536}}
+		spec.gidMap = []idMap{{container: 0, host: 0, size: 1}, {container: 1, host: 300000, size: 65536}}
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		if err != nil && strings.Contains(err.Error(), "operation not permitted") {
+			t.Skip("user namespaces are not permitted: " + err.Error())
+		}
+		require.NoError(t, err, buf.String())
+		artifacts, err := spec.CreatePackages(t.TempDir())
+		require.NoError(t, err)
+		owners := make(map[string][2]int)
+		for _, file := range artifacts[0].Manifest.Files {
+			owners[file.Path] = [2]int{file.UID, file.GID}
+		}
+		assert.Equal(t, [2]int{41, 42}, owners["var/lib/hello"])
+		assert.Equal(t, [2]int{0, 0}, owners["var/lib"])
+	})
+}
+
+func Test_fakerootIDMaps(t *testing.T) {
+	t.Parallel()
+	file := filepath.Join(t.TempDir(), "subuid")
+	data := "other:100000:65536\nbroken:x:1\n1001:165536:1000\nbuilder:231072:65536\n"
+	require.NoError(t, os.WriteFile(file, []byte(data), 0o600))
+	for _, tc := range []struct {
+		name     string
+		user     string
+		id       int
+		expected []idMap
+	}{
+		{
+			name:     "Should map the user to root followed by its subordinate ids",
+			user:     "builder",
+			id:       1000,
+			expected: []idMap{{container: 0, host: 1000, size: 1}, {container: 1, host: 231072, size: 65536}},
+		},
+		{
+			name:     "Should find subordinate ids by user id",
+			user:     "unknown",
+			id:       1001,
+			expected: []idMap{{container: 0, host: 1001, size: 1}, {container: 1, host: 165536, size: 1000}},
+		},
+		{
+			name:     "Should only map the user without subordinate ids",
+			user:     "broken",
+			id:       1002,
+			expected: []idMap{{container: 0, host: 1002, size: 1}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, fakerootIDMaps(file, tc.user, tc.id))
+		})
+	}
+	t.Run("Should only map the user without a subordinate id file", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []idMap{{container: 0, host: 7, size: 1}},
+			fakerootIDMaps(filepath.Join(t.TempDir(), "missing"), "builder", 7))
+	})
+}
+
+func Test_normalizeHeaderOwnership(t *testing.T) {
+	t.Parallel()
+	maps := []idMap{{container: 0, host: 1000, size: 1}, {container: 1, host: 100000, size: 65536}}
+	for _, tc := range []struct {
+		name                     string
+		fakeroot                 bool
+		uid, gid                 int
+		expectedUID, expectedGID int
+	}{
+		{name: "Should map the build user to root", fakeroot: true, uid: 1000, gid: 1000},
+		{name: "Should keep root", fakeroot: true},
+		{
+			name: "Should map subordinate ids to their ids in the namespace", fakeroot: true,
+			uid: 100041, gid: 100099, expectedUID: 42, expectedGID: 100,
+		},
+		{name: "Should keep unmapped ids", fakeroot: true, uid: 5, gid: 6, expectedUID: 5, expectedGID: 6},
+		{name: "Should map the build user to root without fakeroot", uid: 1000, gid: 1000},
+		{
+			name: "Should keep other owners without fakeroot",
+			uid:  100041, gid: 5, expectedUID: 100041, expectedGID: 5,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			spec := &Spec{fakeroot: tc.fakeroot, buildUID: 1000, buildGID: 1000, uidMap: maps, gidMap: maps}
+			header := &tar.Header{Uid: tc.uid, Gid: tc.gid}
+			spec.normalizeHeader(header)
+			assert.Equal(t, tc.expectedUID, header.Uid)
+			assert.Equal(t, tc.expectedGID, header.Gid)
+		})
+	}
+}
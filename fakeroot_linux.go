@@ -0,0 +1,92 @@
+package mere
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// waitForIDMaps makes a stage wait on file descriptor 3 until newuidmap and newgidmap have
+// set up its user namespace. The stage then runs as root and may start commands with the
+// capabilities of root inside of the namespace.
+const waitForIDMaps = "read -r _ <&3 || exit 1\nexec 3<&-\n"
+
+// useFakeroot runs cmd in a new user namespace in which the current user is root, and its
+// subordinate ids, as listed in /etc/subuid and /etc/subgid, are the ids from 1 upwards. Files
+// chowned inside of the namespace are owned by the mapped ids outside of it, from which
+// normalizeHeader recovers their owners. Only root may map ids other than its own directly,
+// other users need the setuid newuidmap and newgidmap helpers. Without them, or without
+// subordinate ids, only the current user is mapped and files can only be owned by root.
+//
+// The returned function, when not nil, must be called once cmd has been started, or with
+// false when starting it failed.
+func (s *Spec) useFakeroot(cmd *exec.Cmd) (func(started bool) error, error) {
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+	if os.Geteuid() == 0 || (len(s.uidMap) == 1 && len(s.gidMap) == 1) {
+		setIDMaps(cmd.SysProcAttr, s.uidMap, s.gidMap)
+		return nil, nil
+	}
+	newuidmap, uidErr := exec.LookPath("newuidmap")
+	newgidmap, gidErr := exec.LookPath("newgidmap")
+	if uidErr != nil || gidErr != nil {
+		s.log.Warn("newuidmap and newgidmap are not available, files can only be owned by root")
+		s.uidMap, s.gidMap = s.uidMap[:1], s.gidMap[:1]
+		setIDMaps(cmd.SysProcAttr, s.uidMap, s.gidMap)
+		return nil, nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errFakeroot, err)
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	script := &cmd.Args[len(cmd.Args)-1]
+	*script = waitForIDMaps + *script
+	return func(started bool) error {
+		r.Close()
+		defer w.Close()
+		if !started {
+			return nil
+		}
+		pid := strconv.Itoa(cmd.Process.Pid)
+		if err := runIDMap(newuidmap, pid, s.uidMap); err != nil {
+			return err
+		}
+		if err := runIDMap(newgidmap, pid, s.gidMap); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\n"); err != nil {
+			return fmt.Errorf("%w: %w", errFakeroot, err)
+		}
+		return nil
+	}, nil
+}
+
+// setIDMaps lets the kernel map the ids when cmd starts.
+func setIDMaps(attr *syscall.SysProcAttr, uidMap, gidMap []idMap) {
+	attr.UidMappings = sysIDMaps(uidMap)
+	attr.GidMappings = sysIDMaps(gidMap)
+	attr.GidMappingsEnableSetgroups = false
+}
+
+func sysIDMaps(maps []idMap) []syscall.SysProcIDMap {
+	sys := make([]syscall.SysProcIDMap, 0, len(maps))
+	for _, m := range maps {
+		sys = append(sys, syscall.SysProcIDMap{ContainerID: m.container, HostID: m.host, Size: m.size})
+	}
+	return sys
+}
+
+// runIDMap writes the id maps of the process pid with newuidmap or newgidmap.
+func runIDMap(helper, pid string, maps []idMap) error {
+	args := []string{pid}
+	for _, m := range maps {
+		args = append(args, strconv.Itoa(m.container), strconv.Itoa(m.host), strconv.Itoa(m.size))
+	}
+	output, err := exec.Command(helper, args...).CombinedOutput() //#nosec
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w: %s", errFakeroot, helper, err, output)
+	}
+	return nil
+}
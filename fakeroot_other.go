@@ -0,0 +1,13 @@
+//go:build !linux
+
+package mere
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// useFakeroot fails, user namespaces only exist on Linux.
+func (s *Spec) useFakeroot(*exec.Cmd) (func(started bool) error, error) {
+	return nil, fmt.Errorf("%w: fakeroot builds require Linux user namespaces", errFakeroot)
+}
@@ -28,7 +28,8 @@ func (c copywrapper) Copy(dst io.Writer, src io.Reader) (int64, error) {
 	return io.Copy(dst, src) //nolint:wrapcheck // We want the simplest possible wrap here
 }
 
-type doer interface {
+// HTTPClient sends HTTP requests, as does an *http.Client.
+type HTTPClient interface {
 	Do(request *http.Request) (*http.Response, error)
 }
 
@@ -54,48 +55,79 @@ func fetchFile(c copier, src string, dest string) error {
 	return nil
 }
 
-// fetchHTTP retrieves an HTTP source and saves the response to a destination file.
-func fetchHTTP(d doer, src string, dest string) error {
+// httpGet requests src and returns the response body, which the caller must close.
+func httpGet(ctx context.Context, d HTTPClient, src string) (io.ReadCloser, error) {
 	var requestBody io.ReadCloser
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, src, requestBody)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, src, requestBody)
 	resp, err := d.Do(req)
 	if err != nil {
-		return fmt.Errorf("%w", err)
+		return nil, fmt.Errorf("%w", err)
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode >= errorBoundary {
-		return fmt.Errorf("%w: %d %s", errHTTPcode, resp.StatusCode, http.StatusText(resp.StatusCode))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d %s", errHTTPcode, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return resp.Body, nil
+}
+
+// fetchHTTP retrieves an HTTP source and saves the response to a destination file.
+func fetchHTTP(ctx context.Context, d HTTPClient, src string, dest string) error {
+	body, err := httpGet(ctx, d, src)
+	if err != nil {
+		return err
 	}
+	defer body.Close()
 	f, err := os.Create(dest)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
-	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
+	if _, err = io.Copy(f, body); err != nil {
+		f.Close()
+		return fmt.Errorf("%w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// fetchAtomic runs fetch with the path of a temporary file next to dest, and renames that file
+// to dest only once fetch succeeds. Interrupted or failed downloads thus never leave a partial
+// file at dest, which later builds would take for a complete one.
+func fetchAtomic(dest string, fetch func(tmp string) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+"-*")
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := fetch(tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("%w", err)
+	}
 	return nil
 }
 
 // fetch takes a given URL u, fetches it using the method appropriate for the
 // protocol scheme and saves it to destFile.
-func (m Mere) fetch(u url.URL, destFile string) error {
+func (m Mere) fetch(ctx context.Context, u url.URL, destFile string) error {
 	destPath, _ := filepath.Abs(destFile)
 	if err := ensureDir(os.MkdirAll, filepath.Dir(destPath)); err != nil {
 		return err
 	}
+	m.log.Debug(fmt.Sprintf("Fetching %s to %s", u.String(), destPath))
 	switch u.Scheme {
 	case fileProto:
-		if err := fetchFile(copywrapper{}, u.Path, destPath); err != nil {
-			return err
-		}
+		return fetchAtomic(destPath, func(tmp string) error {
+			return fetchFile(copywrapper{}, u.Path, tmp)
+		})
 	case httpProto, httpsProto:
-		if err := fetchHTTP(m.httpclient, u.String(), destPath); err != nil {
-			return err
-		}
+		return fetchAtomic(destPath, func(tmp string) error {
+			return fetchHTTP(ctx, m.httpclient, u.String(), tmp)
+		})
 	default:
 		return fmt.Errorf("%w: %s", errBadProtoScheme, u.Scheme)
 	}
-	return nil
 }
@@ -2,6 +2,7 @@ package mere
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -136,7 +137,7 @@ func Test_fetchFile(t *testing.T) {
 func Test_fetchHTTP(t *testing.T) {
 	tests := []struct {
 		description string
-		client      doer
+		client      HTTPClient
 		errMsg      string
 		url         string
 		dest        string
@@ -187,7 +188,7 @@ func Test_fetchHTTP(t *testing.T) {
 			if test.dest == "" {
 				test.dest = "/dev/null"
 			}
-			err := fetchHTTP(test.client, test.url, test.dest)
+			err := fetchHTTP(context.Background(), test.client, test.url, test.dest)
 			if test.errMsg != "" {
 				if err == nil {
 					t.Error("expected an error but did not receive one")
@@ -209,7 +210,7 @@ func Test_fetch(t *testing.T) {
 		src         url.URL
 		dest        string
 		errMsg      string
-		client      doer
+		client      HTTPClient
 	}{
 		{
 			description: "Should detect http and pass through errors from fetchHTTP",
@@ -282,9 +283,8 @@ func Test_fetch(t *testing.T) {
 			assert := assert.New(t)
 			var buf bytes.Buffer
 			log := Log{Output: &buf}
-			mereObj, _ := NewMere(log, "")
-			mereObj.httpclient = test.client
-			err := mereObj.fetch(test.src, test.dest)
+			mereObj, _ := NewMere(WithLogger(log), WithHTTPClient(test.client))
+			err := mereObj.fetch(context.Background(), test.src, test.dest)
 			if test.errMsg == "" {
 				require.NoError(t, err)
 			} else if assert.Error(err) {
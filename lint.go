@@ -0,0 +1,361 @@
+package mere
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/ghodss/yaml"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Rules reported by Lint.
+const (
+	RuleYAML                 = "yaml"
+	RuleSchema               = "schema"
+	RuleTemplateSyntax       = "template-syntax"
+	RuleUnknownTemplateField = "unknown-template-field"
+	RuleUntemplatedSource    = "untemplated-source"
+	RuleInsecureURL          = "insecure-url"
+	RuleDuplicatePackage     = "duplicate-package"
+	RuleOverlappingFiles     = "overlapping-files"
+	RulePackageNoFiles       = "package-no-files"
+	RuleEmptyInstall         = "empty-install"
+	RuleReleaseNotReset      = "release-not-reset"
+)
+
+// Diagnostic is a problem found in a spec file by Lint.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// String formats the diagnostic as file:line:column: rule: message.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Rule, d.Message)
+}
+
+// headReader returns the contents of a file as of the last commit.
+type headReader interface {
+	readHead(path string) ([]byte, error)
+}
+
+type gitHead struct{}
+
+func (gitHead) readHead(path string) ([]byte, error) {
+	out, err := exec.Command("git", "-C", filepath.Dir(path), "show", "HEAD:./"+filepath.Base(path)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return out, nil
+}
+
+// linter holds the state of linting a single spec file.
+type linter struct {
+	path        string
+	nodes       *specLocator
+	spec        *Spec
+	diagnostics []Diagnostic
+}
+
+// add records a diagnostic for the error, whose field is part of the message.
+func (l *linter) add(rule string, fe FieldError) {
+	message := fe.Message
+	if fe.Field != "" {
+		message = fe.Field + ": " + message
+	}
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		File:    fe.File,
+		Line:    fe.Line,
+		Column:  fe.Column,
+		Rule:    rule,
+		Message: message,
+	})
+}
+
+func (l *linter) report(path, rule, format string, args ...any) {
+	fe := l.nodes.fieldError(path, format, args...)
+	fe.Field = ""
+	l.add(rule, fe)
+}
+
+// checkSchema validates the spec file against the schema of Spec and decodes it, without
+// rendering any templates. It returns false when the spec is invalid.
+func (l *linter) checkSchema(data []byte) bool {
+	jsondata, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		l.report("", RuleYAML, "%s", err)
+		return false
+	}
+	errs, err := l.nodes.schemaErrors(jsondata)
+	if err != nil {
+		l.report("", RuleSchema, "%s", err)
+		return false
+	}
+	for _, fe := range errs {
+		l.add(RuleSchema, fe)
+	}
+	if len(errs) > 0 {
+		return false
+	}
+	l.spec = new(Spec)
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(jsondata, l.spec); err != nil {
+		l.report("", RuleSchema, "%s", err)
+		return false
+	}
+	return true
+}
+
+// templateFields collects the fields referenced from the dot of a template, such as
+// [Upstream URL] for {{.Upstream.URL}}. The bodies of range and with change the dot and
+// are not inspected.
+func templateFields(node parse.Node, fields *[][]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		templateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				templateFields(arg, fields)
+			}
+		}
+	case *parse.FieldNode:
+		*fields = append(*fields, n.Ident)
+	case *parse.IfNode:
+		templateFields(n.Pipe, fields)
+		templateFields(n.List, fields)
+		templateFields(n.ElseList, fields)
+	case *parse.RangeNode:
+		templateFields(n.Pipe, fields)
+	case *parse.WithNode:
+		templateFields(n.Pipe, fields)
+	}
+}
+
+// knownTemplateField reports whether a template may evaluate the field of the spec. Vars
+// must be defined by the spec.
+func knownTemplateField(spec *Spec, ident []string) bool {
+	if len(ident) > 1 && ident[0] == "Vars" {
+		_, ok := spec.Vars[ident[1]]
+		return ok && len(ident) == 2
+	}
+	t := reflect.TypeOf(Spec{})
+	for _, name := range ident {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if _, ok := reflect.PointerTo(t).MethodByName(name); ok {
+			return true
+		}
+		switch t.Kind() { //nolint:exhaustive // other kinds have no fields
+		case reflect.Struct:
+			f, ok := t.FieldByName(name)
+			if !ok || !f.IsExported() {
+				return false
+			}
+			t = f.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// checkTemplates reports templates which do not parse or which refer to unknown fields,
+// including those of the overrides of every architecture.
+func (l *linter) checkTemplates() {
+	for _, field := range append(l.spec.templatedFields(), l.spec.overrideFields()...) {
+		tmpl, err := newTemplate(field.value)
+		if err != nil {
+			fe := l.nodes.templateError(field.path, err)
+			fe.Field = ""
+			l.add(RuleTemplateSyntax, fe)
+			continue
+		}
+		var fields [][]string
+		templateFields(tmpl.Root, &fields)
+		for _, ident := range fields {
+			if !knownTemplateField(l.spec, ident) {
+				l.report(field.path, RuleUnknownTemplateField, "unknown template field .%s", strings.Join(ident, "."))
+			}
+		}
+	}
+}
+
+// checkURLs reports remote sources, including those of overrides, which are not templated on
+// the version, and URLs which do not use TLS. Vars are checked as they often hold mirrors.
+func (l *linter) checkURLs() {
+	urls := map[string]string{"home": l.spec.Home}
+	addSources := func(prefix string, sources []Source) {
+		for i, source := range sources {
+			field := fmt.Sprintf("%ssources.%d.url", prefix, i)
+			urls[field] = source.URL
+			remote := strings.HasPrefix(source.URL, "http://") || strings.HasPrefix(source.URL, "https://")
+			if remote && !strings.Contains(source.URL, ".Version") {
+				l.report(field, RuleUntemplatedSource, "source URL is not templated on {{.Version}}")
+			}
+		}
+	}
+	addSources("", l.spec.Sources)
+	for _, arch := range sortedKeys(l.spec.Overrides) {
+		addSources("overrides."+arch+".", l.spec.Overrides[arch].Sources)
+	}
+	if l.spec.Upstream != nil {
+		urls["upstream.url"] = l.spec.Upstream.URL
+	}
+	for key, value := range l.spec.Vars {
+		urls["vars."+key] = value
+	}
+	for _, field := range sortedKeys(urls) {
+		rendered, err := l.spec.render(urls[field])
+		if err != nil {
+			continue
+		}
+		if u, err := url.Parse(rendered); err == nil && u.Scheme == "http" {
+			l.report(field, RuleInsecureURL, "%s does not use TLS, use https", rendered)
+		}
+	}
+}
+
+// globCovers reports whether pattern matches name or any of its parent directories.
+func globCovers(pattern, name string) bool {
+	for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// globsOverlap reports whether two files globs of packages may claim the same files.
+func globsOverlap(a, b string) bool {
+	a, b = strings.TrimPrefix(a, "/"), strings.TrimPrefix(b, "/")
+	return globCovers(a, b) || globCovers(b, a)
+}
+
+// checkPackages reports duplicate packages, files globs claimed by more than one package and
+// packages which cannot receive any files.
+func (l *linter) checkPackages() {
+	names := make(map[string]int)
+	remainder := -1
+	for i, p := range l.spec.Packages {
+		if j, ok := names[p.Name]; ok {
+			l.report(fmt.Sprintf("packages.%d.name", i), RuleDuplicatePackage,
+				"package %s is already defined at line %d", p.Name, l.nodes.fieldError(fmt.Sprintf("packages.%d.name", j), "").Line)
+		} else {
+			names[p.Name] = i
+		}
+		if len(p.Files) == 0 {
+			if remainder < 0 {
+				remainder = i
+			} else {
+				l.report(fmt.Sprintf("packages.%d.name", i), RulePackageNoFiles,
+					"package %s has no files, package %s receives every file not claimed by another package",
+					p.Name, l.spec.Packages[remainder].Name)
+			}
+		}
+		for ii, pattern := range p.Files {
+			for j := range i {
+				for _, other := range l.spec.Packages[j].Files {
+					if globsOverlap(pattern, other) {
+						l.report(fmt.Sprintf("packages.%d.files.%d", i, ii), RuleOverlappingFiles,
+							"%s overlaps %s of package %s, which takes precedence", pattern, other, l.spec.Packages[j].Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkInstall reports specs whose install stage does nothing, such that their packages are empty.
+func (l *linter) checkInstall() {
+	if err := l.spec.setupStages(); err != nil {
+		l.report("stages", RuleSchema, "%s", err)
+		return
+	}
+	for _, stage := range l.spec.buildOrder {
+		if stage.Name == installStage && strings.TrimSpace(stage.Cmd) != "" {
+			return
+		}
+	}
+	l.report("install", RuleEmptyInstall, "there is no install command, the packages will be empty")
+}
+
+// checkRelease reports a release which was not reset to 1 when the version changed since the
+// last commit of the spec.
+func (l *linter) checkRelease(head headReader) {
+	data, err := head.readHead(l.path)
+	if err != nil {
+		// The spec is not committed, or not in a git repository.
+		return
+	}
+	var previous struct {
+		Version string `json:"version"`
+	}
+	if err := yaml.Unmarshal(data, &previous); err != nil || previous.Version == "" {
+		return
+	}
+	if previous.Version != l.spec.Version && l.spec.Release != 1 {
+		l.report("release", RuleReleaseNotReset, "version changed from %s to %s since the last commit, reset release to 1",
+			previous.Version, l.spec.Version)
+	}
+}
+
+// Lint checks the spec file at path for problems beyond those reported by NewSpec, such as
+// source URLs not templated on the version, URLs without TLS, packages claiming the same files,
+// templates referring to unknown fields and a release not reset after the version changed
+// since the last git commit. The diagnostics are sorted by their position in the file.
+func Lint(path string) ([]Diagnostic, error) {
+	return lint(path, gitHead{})
+}
+
+func lint(path string, head headReader) ([]Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	nodes, yamlErr := newSpecLocator(path, data)
+	if yamlErr != nil {
+		return []Diagnostic{{
+			File: path, Line: yamlErr.Line, Column: yamlErr.Column, Rule: RuleYAML, Message: yamlErr.Message,
+		}}, nil
+	}
+	l := &linter{path: path, nodes: nodes}
+	if l.checkSchema(data) {
+		l.checkTemplates()
+		l.checkURLs()
+		l.checkPackages()
+		l.checkInstall()
+		l.checkRelease(head)
+	}
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i], l.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.diagnostics, nil
+}
@@ -0,0 +1,133 @@
+package mere
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHead returns the same contents for any file, or an error when there are none.
+type fakeHead struct {
+	data []byte
+}
+
+func (f fakeHead) readHead(string) ([]byte, error) {
+	if f.data == nil {
+		return nil, errors.New("not committed")
+	}
+	return f.data, nil
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		path     string
+		head     []byte
+		expected []Diagnostic
+	}{
+		{
+			name: "Should report nothing for a good spec",
+			path: "testdata/spec.yaml",
+			head: []byte("version: 1.1.23\n"),
+		},
+		{
+			name: "Should report every problem with its position",
+			path: "testdata/lint/problems.yaml",
+			head: []byte("version: \"1.0\"\n"),
+			expected: []Diagnostic{
+				{Line: 4, Column: 10, Rule: RuleReleaseNotReset,
+					Message: "version changed from 1.0 to 2.0 since the last commit, reset release to 1"},
+				{Line: 5, Column: 7, Rule: RuleInsecureURL, Message: "http://example.com does not use TLS, use https"},
+				{Line: 7, Column: 10, Rule: RuleUntemplatedSource, Message: "source URL is not templated on {{.Version}}"},
+				{Line: 9, Column: 10, Rule: RuleInsecureURL,
+					Message: "http://example.com/hello-2.0-docs.tar.gz does not use TLS, use https"},
+				{Line: 17, Column: 9, Rule: RuleOverlappingFiles,
+					Message: "usr/lib/*.a overlaps usr/lib of package hello, which takes precedence"},
+				{Line: 19, Column: 11, Rule: RuleDuplicatePackage, Message: "package hello is already defined at line 12"},
+				{Line: 19, Column: 11, Rule: RulePackageNoFiles,
+					Message: "package hello has no files, package hello-doc receives every file not claimed by another package"},
+				{Line: 20, Column: 11, Rule: RulePackageNoFiles,
+					Message: "package hello-extra has no files, package hello-doc receives every file not claimed by another package"},
+				{Line: 21, Column: 8, Rule: RuleUnknownTemplateField, Message: "unknown template field .Destdir"},
+				{Line: 21, Column: 8, Rule: RuleUnknownTemplateField, Message: "unknown template field .Vars.series"},
+				{Line: 23, Column: 10, Rule: RuleEmptyInstall, Message: "there is no install command, the packages will be empty"},
+				{Line: 25, Column: 11, Rule: RuleInsecureURL, Message: "http://mirror.example.com does not use TLS, use https"},
+				{Line: 29, Column: 14, Rule: RuleUntemplatedSource, Message: "source URL is not templated on {{.Version}}"},
+				{Line: 29, Column: 14, Rule: RuleInsecureURL,
+					Message: "http://example.com/hello-arm64.tar.gz does not use TLS, use https"},
+				{Line: 31, Column: 12, Rule: RuleUnknownTemplateField, Message: "unknown template field .Flags"},
+				{Line: 33, Column: 15, Rule: RuleUnknownTemplateField, Message: "unknown template field .Vars.cflags"},
+			},
+		},
+		{
+			name: "Should not report the release when the version is unchanged",
+			path: "testdata/spec_with_packages.yaml",
+			head: []byte("version: 1.1.23\n"),
+		},
+		{
+			name: "Should report schema errors at their field",
+			path: "testdata/bad_spec.yaml",
+			expected: []Diagnostic{
+				{Line: 4, Column: 10, Rule: RuleSchema, Message: "release: Invalid type. Expected: integer, given: string"},
+			},
+		},
+		{
+			name: "Should report template syntax errors",
+			path: "testdata/bad_template_spec.yaml",
+			expected: []Diagnostic{
+				{Line: 1, Column: 1, Rule: RuleEmptyInstall, Message: "there is no install command, the packages will be empty"},
+				{Line: 7, Column: 11, Rule: RuleTemplateSyntax, Message: "bad character U+007D '}'"},
+			},
+		},
+		{
+			name: "Should report YAML errors",
+			path: "testdata/lint/bad_yaml.yaml",
+			expected: []Diagnostic{
+				{Line: 5, Column: 4, Rule: RuleYAML, Message: "did not find expected '-' indicator"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			diagnostics, err := lint(tt.path, fakeHead{data: tt.head})
+			require.NoError(t, err)
+			for i := range tt.expected {
+				tt.expected[i].File = tt.path
+			}
+			if tt.expected == nil {
+				tt.expected = []Diagnostic(nil)
+			}
+			assert.Equal(t, tt.expected, diagnostics)
+		})
+	}
+	t.Run("Should fail for a missing file", func(t *testing.T) {
+		t.Parallel()
+		_, err := Lint("testdata/missing.yaml")
+		require.Error(t, err)
+	})
+}
+
+func Test_globsOverlap(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{a: "lib", b: "lib/libc.so", expected: true},
+		{a: "lib/*.a", b: "lib/*.o", expected: false},
+		{a: "/usr/lib/*", b: "usr/lib/libz.so", expected: true},
+		{a: "usr/lib/*", b: "usr/lib/pkgconfig/z.pc", expected: true},
+		{a: "bin", b: "sbin", expected: false},
+		{a: "include", b: "include", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.expected, globsOverlap(tt.a, tt.b))
+		})
+	}
+}
@@ -3,12 +3,15 @@ package mere
 import (
 	"fmt"
 	"io"
+	"log/slog"
 )
 
-// Logger is an interface that presents only two main logging methods, Info and Debug.
+// Logger is an interface that presents leveled logging methods.
 type Logger interface {
 	Info(message string)
 	Debug(message string)
+	Warn(message string)
+	Error(message string)
 }
 
 // Log provides an implementation of Logger.
@@ -26,3 +29,75 @@ func (l Log) Debug(msg string) {
 		fmt.Fprintln(l.Output, msg)
 	}
 }
+
+func (l Log) Warn(msg string) {
+	fmt.Fprintln(l.Output, "warning:", msg)
+}
+
+func (l Log) Error(msg string) {
+	fmt.Fprintln(l.Output, "error:", msg)
+}
+
+// fieldLogger is implemented by Loggers which can attach structured fields to their messages.
+type fieldLogger interface {
+	With(args ...any) Logger
+}
+
+// withFields returns a Logger which includes the given key-value pairs in every message,
+// when supported by log. Otherwise log is returned unchanged.
+func withFields(log Logger, args ...any) Logger {
+	if fl, ok := log.(fieldLogger); ok {
+		return fl.With(args...)
+	}
+	return log
+}
+
+// SlogLogger provides an implementation of Logger backed by a log/slog Logger.
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+// NewJSONLog returns a Logger which writes each message to w as a line of JSON,
+// containing the timestamp, level, message and any fields such as spec, version and stage.
+func NewJSONLog(w io.Writer, enableDebug bool) SlogLogger {
+	level := slog.LevelInfo
+	if enableDebug {
+		level = slog.LevelDebug
+	}
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 {
+				switch attr.Key {
+				case slog.TimeKey:
+					attr.Key = "timestamp"
+				case slog.MessageKey:
+					attr.Key = "message"
+				}
+			}
+			return attr
+		},
+	})
+	return SlogLogger{Logger: slog.New(handler)}
+}
+
+func (l SlogLogger) Info(msg string) {
+	l.Logger.Info(msg)
+}
+
+func (l SlogLogger) Debug(msg string) {
+	l.Logger.Debug(msg)
+}
+
+func (l SlogLogger) Warn(msg string) {
+	l.Logger.Warn(msg)
+}
+
+func (l SlogLogger) Error(msg string) {
+	l.Logger.Error(msg)
+}
+
+// With returns a Logger which includes the given key-value pairs in every message.
+func (l SlogLogger) With(args ...any) Logger {
+	return SlogLogger{Logger: l.Logger.With(args...)}
+}
@@ -2,10 +2,13 @@ package mere_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/jhuntwork/mere"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const msg = "test message"
@@ -41,3 +44,62 @@ func TestDebugInfo(t *testing.T) {
 		assert.Equal(msg+"\n", buf.String())
 	})
 }
+
+func TestLogWarn(t *testing.T) {
+	t.Parallel()
+	t.Run("Should output a prefixed message", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		var buf bytes.Buffer
+		log := mere.Log{Output: &buf}
+		log.Warn(msg)
+		assert.Equal("warning: "+msg+"\n", buf.String())
+	})
+}
+
+func TestLogError(t *testing.T) {
+	t.Parallel()
+	t.Run("Should output a prefixed message", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		var buf bytes.Buffer
+		log := mere.Log{Output: &buf}
+		log.Error(msg)
+		assert.Equal("error: "+msg+"\n", buf.String())
+	})
+}
+
+func TestJSONLog(t *testing.T) {
+	t.Parallel()
+	t.Run("Should output a JSON line per message", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		log := mere.NewJSONLog(&buf, false)
+		log.Warn(msg)
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		assert.Equal(t, "WARN", entry["level"])
+		assert.Equal(t, msg, entry["message"])
+		assert.Contains(t, entry, "timestamp")
+	})
+	t.Run("Should only output debug messages when enabled", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		mere.NewJSONLog(&buf, false).Debug(msg)
+		assert.Empty(t, buf.String())
+		mere.NewJSONLog(&buf, true).Debug(msg)
+		assert.Contains(t, buf.String(), `"level":"DEBUG"`)
+	})
+	t.Run("Should include spec and stage fields during a build", func(t *testing.T) {
+		t.Parallel()
+		var buf, out bytes.Buffer
+		spec, err := mere.NewSpec("testdata/spec_no_sources.yaml",
+			mere.WithLogger(mere.NewJSONLog(&buf, false)), mere.WithStageOutput(&out, &out))
+		require.NoError(t, err)
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(),
+			`"message":"Executing stage build","spec":"musl","version":"1.1.23","stage":"build"}`)
+	})
+}
@@ -29,7 +29,7 @@ const (
 
 type Mere struct {
 	log        Logger
-	httpclient doer
+	httpclient HTTPClient
 	store      string
 }
 
@@ -48,17 +48,24 @@ func validateURL(u string) (*url.URL, error) {
 	}
 }
 
-func NewMere(log Logger, store string) (Mere, error) {
-	if store == "" {
-		store = defaultStorePath
+// NewMere constructs and validates a new Mere. The store, logger and HTTP client
+// may be set with WithStore, WithLogger and WithHTTPClient.
+func NewMere(opts ...Option) (Mere, error) {
+	o := newOptions(opts)
+	mere := Mere{log: o.log, store: o.resolveStore(), httpclient: o.httpclient}
+	if mere.httpclient == nil {
+		mere.httpclient = newHTTPClient()
 	}
-	mere := Mere{log: log, store: store}
+	return mere, mere.validate()
+}
+
+// newHTTPClient returns the default client used for HTTP requests.
+func newHTTPClient() *http.Client {
 	transport, _ := aia.NewTransport()
-	mere.httpclient = &http.Client{
+	return &http.Client{
 		Timeout:   time.Second * httpTimeout,
 		Transport: transport,
 	}
-	return mere, mere.validate()
 }
 
 func (m *Mere) validate() error {
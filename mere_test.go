@@ -15,14 +15,14 @@ func TestNewMere(t *testing.T) {
 		t.Parallel()
 		var buf bytes.Buffer
 		log := mere.Log{Output: &buf}
-		_, err := mere.NewMere(log, "testdata/non-existent-dir")
+		_, err := mere.NewMere(mere.WithLogger(log), mere.WithStore("testdata/non-existent-dir"))
 		require.ErrorIs(t, err, os.ErrNotExist)
 	})
 	t.Run("Should fail if the given store is a file", func(t *testing.T) {
 		t.Parallel()
 		var buf bytes.Buffer
 		log := mere.Log{Output: &buf}
-		_, err := mere.NewMere(log, "testdata/spec.yaml")
+		_, err := mere.NewMere(mere.WithLogger(log), mere.WithStore("testdata/spec.yaml"))
 		require.ErrorIs(t, err, mere.ErrStoreIsFile)
 	})
 	t.Run("Should fail if the given store has incorrect permissions", func(t *testing.T) {
@@ -36,7 +36,7 @@ func TestNewMere(t *testing.T) {
 		require.NoError(t, err)
 		var buf bytes.Buffer
 		log := mere.Log{Output: &buf}
-		_, err = mere.NewMere(log, dir)
+		_, err = mere.NewMere(mere.WithLogger(log), mere.WithStore(dir))
 		require.ErrorIs(t, err, mere.ErrStoreBadPermissions)
 	})
 	/*
@@ -45,7 +45,7 @@ func TestNewMere(t *testing.T) {
 			assert := assert.New(t)
 			var buf bytes.Buffer
 			log := mere.Log{Output: &buf}
-			_, err := mere.NewMere(log, "testdata/spec.yaml")
+			_, err := mere.NewMere(mere.WithLogger(log), mere.WithStore("testdata/spec.yaml"))
 			assert.ErrorIs(err, mere.ErrStoreBadGroup)
 		})
 	*/
@@ -60,7 +60,7 @@ func TestNewMere(t *testing.T) {
 		require.NoError(t, err)
 		var buf bytes.Buffer
 		log := mere.Log{Output: &buf}
-		_, err = mere.NewMere(log, dir)
+		_, err = mere.NewMere(mere.WithLogger(log), mere.WithStore(dir))
 		require.NoError(t, err)
 	})
 }
@@ -0,0 +1,315 @@
+package mere
+
+import (
+	"io"
+	"maps"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// Option configures optional behavior of the constructors in this package.
+type Option func(*options)
+
+type options struct {
+	config         *Config
+	log            Logger
+	stdout         io.Writer
+	stderr         io.Writer
+	httpclient     HTTPClient
+	sourceCache    string
+	buildCache     string
+	repo           string
+	parallel       int
+	force          bool
+	depVersions    map[string]string
+	workDir        string
+	logDir         string
+	onlyStages     []string
+	skipStages     []string
+	resume         string
+	shellOnFailure bool
+	fakeroot       bool
+	timeout        time.Duration
+	stageTimeouts  map[string]time.Duration
+	env            map[string]string
+	store          string
+	arch           string
+}
+
+// WithConfig provides the settings of the configuration file, as read by LoadConfig. Without it
+// the constructors of this package use an empty Config.
+func WithConfig(config Config) Option {
+	return func(o *options) {
+		o.config = &config
+	}
+}
+
+// WithLogger sets the Logger used to report progress.
+func WithLogger(log Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// WithStageOutput sets where the standard output and standard error of build stages are written.
+// By default they are written to the standard output and standard error of the process.
+func WithStageOutput(stdout, stderr io.Writer) Option {
+	return func(o *options) {
+		o.stdout = stdout
+		o.stderr = stderr
+	}
+}
+
+// WithHTTPClient sets the client used to fetch HTTP sources. By default an *http.Client is used.
+func WithHTTPClient(client HTTPClient) Option {
+	return func(o *options) {
+		o.httpclient = client
+	}
+}
+
+// WithWorkDir sets the directory in which build working directories are created.
+// By default the system temp directory is used.
+func WithWorkDir(dir string) Option {
+	return func(o *options) {
+		o.workDir = dir
+	}
+}
+
+// WithLogDir sets a directory in which stage logs and the build summary are kept.
+// Unlike the logs in the working directory, they are not removed by Cleanup.
+func WithLogDir(dir string) Option {
+	return func(o *options) {
+		o.logDir = dir
+	}
+}
+
+// WithOnlyStages limits a build to the named stages.
+func WithOnlyStages(names ...string) Option {
+	return func(o *options) {
+		o.onlyStages = append(o.onlyStages, names...)
+	}
+}
+
+// WithSkipStages excludes the named stages from a build.
+func WithSkipStages(names ...string) Option {
+	return func(o *options) {
+		o.skipStages = append(o.skipStages, names...)
+	}
+}
+
+// WithResume reuses the working directory of a previous build, as returned by Spec.WorkingDir,
+// instead of fetching and extracting sources into a new one.
+func WithResume(workingDir string) Option {
+	return func(o *options) {
+		o.resume = workingDir
+	}
+}
+
+// WithShellOnFailure starts an interactive shell when a stage fails, in the stage's directory
+// and with its exact environment, user namespace and resource limits. The shell is given the
+// terminal, so that Ctrl-C does not abort the build. The build returns once the shell exits.
+func WithShellOnFailure() Option {
+	return func(o *options) {
+		o.shellOnFailure = true
+	}
+}
+
+// WithFakeroot runs build stages in a user namespace in which the building user is root,
+// so that stages may chown files to root when mere runs as a normal user. The subordinate
+// ids of the user are mapped too, so that stages may also chown files to other users.
+func WithFakeroot() Option {
+	return func(o *options) {
+		o.fakeroot = true
+	}
+}
+
+// WithTimeout sets the maximum duration of a build, overriding the timeout of the spec.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithStageTimeouts sets the maximum durations of stages, by stage name, overriding the timeouts
+// of the spec's stages. It may be given more than once, later values take precedence.
+func WithStageTimeouts(timeouts map[string]time.Duration) Option {
+	return func(o *options) {
+		if o.stageTimeouts == nil {
+			o.stageTimeouts = make(map[string]time.Duration, len(timeouts))
+		}
+		maps.Copy(o.stageTimeouts, timeouts)
+	}
+}
+
+// WithArch sets the architecture to build for, such as aarch64, which selects the overrides of
+// the spec. It defaults to the architecture of the host.
+func WithArch(arch string) Option {
+	return func(o *options) {
+		o.arch = arch
+	}
+}
+
+// WithEnv adds variables to the environment of every build stage.
+// It may be given more than once, later values take precedence.
+func WithEnv(env map[string]string) Option {
+	return func(o *options) {
+		if o.env == nil {
+			o.env = make(map[string]string, len(env))
+		}
+		maps.Copy(o.env, env)
+	}
+}
+
+// WithStore sets the location of the package store used by Mere. An empty path selects
+// the default store.
+func WithStore(path string) Option {
+	return func(o *options) {
+		o.store = path
+	}
+}
+
+// WithSourceCache sets the directory in which fetched sources are stored.
+func WithSourceCache(path string) Option {
+	return func(o *options) {
+		o.sourceCache = path
+	}
+}
+
+// WithBuildCache sets the directory in which the packages of previous builds are kept.
+func WithBuildCache(path string) Option {
+	return func(o *options) {
+		o.buildCache = path
+	}
+}
+
+// WithRepo sets the local repo into which build-all adds packages. When a repo is set, the
+// build dependencies of a spec available in it are installed before its stages run.
+func WithRepo(path string) Option {
+	return func(o *options) {
+		o.repo = path
+	}
+}
+
+// WithParallel sets the number of specs BuildAll builds at once.
+func WithParallel(n int) Option {
+	return func(o *options) {
+		o.parallel = n
+	}
+}
+
+// WithForce makes BuildAll build specs even when their packages are in the build cache.
+func WithForce() Option {
+	return func(o *options) {
+		o.force = true
+	}
+}
+
+// WithDepVersions provides the versions of build dependencies, by name, such as 1.2.3-1.
+// They are part of the build key, so that a spec is rebuilt when a dependency changes.
+func WithDepVersions(versions map[string]string) Option {
+	return func(o *options) {
+		if o.depVersions == nil {
+			o.depVersions = make(map[string]string, len(versions))
+		}
+		maps.Copy(o.depVersions, versions)
+	}
+}
+
+// newOptions applies opts over the defaults. The configuration file is never read here, without
+// WithConfig the Config is empty.
+func newOptions(opts []Option) *options {
+	o := &options{
+		config: &Config{},
+		log:    Log{Output: os.Stdout},
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// resolveSourceCache determines the source cache location. In order of preference it is
+// taken from WithSourceCache, $MERE_SOURCE_CACHE, the configuration file or the default.
+func (o *options) resolveSourceCache() string {
+	switch {
+	case o.sourceCache != "":
+		return o.sourceCache
+	case os.Getenv(envSourceCache) != "":
+		return os.Getenv(envSourceCache)
+	case o.config.SourceCache != "":
+		return o.config.SourceCache
+	default:
+		return defaultSourceCache()
+	}
+}
+
+// resolveStore determines the location of the package store, falling back to the default.
+func (o *options) resolveStore() string {
+	return valueOr(o.store, defaultStorePath)
+}
+
+// defaultSourceCache returns the default location in which fetched sources are stored.
+func defaultSourceCache() string {
+	return defaultCacheDir(srcDir)
+}
+
+// resolveBuildCache determines the build cache location. In order of preference it is
+// taken from WithBuildCache, $MERE_BUILD_CACHE, the configuration file or the default.
+func (o *options) resolveBuildCache() string {
+	switch {
+	case o.buildCache != "":
+		return o.buildCache
+	case os.Getenv(envBuildCache) != "":
+		return os.Getenv(envBuildCache)
+	case o.config.BuildCache != "":
+		return o.config.BuildCache
+	default:
+		return defaultCacheDir(buildsDir)
+	}
+}
+
+// configuredRepo determines the repo location from WithRepo, $MERE_REPO or the configuration
+// file, in order of preference. It is empty if none of them set one.
+func (o *options) configuredRepo() string {
+	switch {
+	case o.repo != "":
+		return o.repo
+	case os.Getenv(envRepo) != "":
+		return os.Getenv(envRepo)
+	default:
+		return o.config.Repo
+	}
+}
+
+// resolveRepo determines the repo location, falling back to the default.
+func (o *options) resolveRepo() string {
+	if repo := o.configuredRepo(); repo != "" {
+		return repo
+	}
+	return defaultCacheDir(repoDir)
+}
+
+// defaultCacheDir returns the default location of the named cache directory. Builds run as
+// root use a system-wide cache under the store, others use their home directory and fall back
+// to the system temp directory if there is none.
+func defaultCacheDir(name string) string {
+	if os.Geteuid() == 0 {
+		return defaultStorePath + name
+	}
+	if u, err := user.Current(); err == nil && u.HomeDir != "" && u.HomeDir != "/" {
+		return u.HomeDir + configDir + name
+	}
+	return filepath.Join(os.TempDir(), "mere"+name)
+}
+
+// resolveLogDir determines the directory in which stage logs are kept, if any.
+func (o *options) resolveLogDir() string {
+	if o.logDir != "" {
+		return o.logDir
+	}
+	return o.config.LogDir
+}
@@ -0,0 +1,168 @@
+package mere
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_resolveSourceCache(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		env         string
+		expected    string
+	}{
+		{
+			description: "Should prefer the WithSourceCache option",
+			opts:        []Option{WithSourceCache("/opt/src"), WithConfig(Config{SourceCache: "/config/src"})},
+			env:         "/env/src",
+			expected:    "/opt/src",
+		},
+		{
+			description: "Should prefer the environment over the config file",
+			opts:        []Option{WithConfig(Config{SourceCache: "/config/src"})},
+			env:         "/env/src",
+			expected:    "/env/src",
+		},
+		{
+			description: "Should use the config file",
+			opts:        []Option{WithConfig(Config{SourceCache: "/config/src"})},
+			expected:    "/config/src",
+		},
+		{
+			description: "Should fall back to the default",
+			opts:        []Option{WithConfig(Config{})},
+			expected:    defaultSourceCache(),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Setenv(envSourceCache, tc.env)
+			o := newOptions(tc.opts)
+			assert.Equal(t, tc.expected, o.resolveSourceCache())
+		})
+	}
+}
+
+func Test_resolveBuildCache(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		env         string
+		expected    string
+	}{
+		{
+			description: "Should prefer the WithBuildCache option",
+			opts:        []Option{WithBuildCache("/opt/builds"), WithConfig(Config{BuildCache: "/config/builds"})},
+			env:         "/env/builds",
+			expected:    "/opt/builds",
+		},
+		{
+			description: "Should prefer the environment over the config file",
+			opts:        []Option{WithConfig(Config{BuildCache: "/config/builds"})},
+			env:         "/env/builds",
+			expected:    "/env/builds",
+		},
+		{
+			description: "Should fall back to the default",
+			opts:        []Option{WithConfig(Config{})},
+			expected:    defaultCacheDir(buildsDir),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Setenv(envBuildCache, tc.env)
+			o := newOptions(tc.opts)
+			assert.Equal(t, tc.expected, o.resolveBuildCache())
+		})
+	}
+}
+
+func Test_newOptions(t *testing.T) {
+	t.Run("Should not read the configuration file without WithConfig", func(t *testing.T) {
+		t.Setenv(envConfig, "testdata/config.yaml")
+		assert.Equal(t, &Config{}, newOptions(nil).config)
+	})
+	t.Run("Should use the given config", func(t *testing.T) {
+		t.Setenv(envConfig, "testdata/bad_yaml.txt")
+		o := newOptions([]Option{WithConfig(Config{SourceCache: "/config/src"})})
+		assert.Equal(t, "/config/src", o.config.SourceCache)
+	})
+}
+
+func Test_resolveStore(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		description string
+		opts        []Option
+		expected    string
+	}{
+		{
+			description: "Should use the WithStore option",
+			opts:        []Option{WithStore("/opt/store")},
+			expected:    "/opt/store",
+		},
+		{
+			description: "Should fall back to the default for an empty store",
+			opts:        []Option{WithStore("")},
+			expected:    defaultStorePath,
+		},
+		{
+			description: "Should fall back to the default without WithStore",
+			expected:    defaultStorePath,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			o := newOptions(append(tc.opts, WithConfig(Config{})))
+			assert.Equal(t, tc.expected, o.resolveStore())
+		})
+	}
+}
+
+func Test_defaultSourceCache(t *testing.T) {
+	t.Parallel()
+	t.Run("Should use the store for root and a home directory otherwise", func(t *testing.T) {
+		t.Parallel()
+		if os.Geteuid() == 0 {
+			assert.Equal(t, "/mere/src", defaultSourceCache())
+		} else {
+			assert.Contains(t, defaultSourceCache(), "/src")
+		}
+	})
+}
+
+func TestNewSpecOptions(t *testing.T) {
+	t.Parallel()
+	t.Run("Should apply the given options", func(t *testing.T) {
+		t.Parallel()
+		log := Log{Output: os.Stderr, EnableDebug: true}
+		client := &goodHTTP{}
+		spec, err := NewSpec("testdata/spec.yaml",
+			WithConfig(Config{}),
+			WithLogger(log),
+			WithHTTPClient(client),
+			WithSourceCache("/opt/src"),
+			WithWorkDir("/opt/work"),
+			WithEnv(map[string]string{"FOO": "foo", "BAR": "bar"}),
+			WithEnv(map[string]string{"FOO": "override"}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, log, spec.log)
+		assert.Equal(t, client, spec.httpclient)
+		assert.Equal(t, "/opt/src", spec.sourceCache)
+		assert.Equal(t, "/opt/work", spec.workRoot)
+		assert.Equal(t, map[string]string{"FOO": "override", "BAR": "bar"}, spec.env)
+	})
+	t.Run("Should create a default HTTP client when there are HTTP sources", func(t *testing.T) {
+		t.Parallel()
+		spec, err := NewSpec("testdata/spec.yaml", WithConfig(Config{}))
+		require.NoError(t, err)
+		assert.NotNil(t, spec.httpclient)
+		assert.Equal(t, Log{Output: os.Stdout}, spec.log)
+	})
+}
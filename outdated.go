@@ -0,0 +1,113 @@
+package mere
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Reasons for a spec to be reported by Outdated.
+const (
+	ReasonNew        = "new"
+	ReasonNewer      = "newer"
+	ReasonDependency = "dependency"
+)
+
+// OutdatedSpec describes a spec which needs to be built because the repo lacks its
+// current version, or because one of its build dependencies changed.
+type OutdatedSpec struct {
+	Spec string `json:"spec"`
+	Path string `json:"path"`
+	// Version is the version and release of the spec.
+	Version string `json:"version"`
+	// RepoVersion is the version and release of the spec's packages in the repo, if any.
+	RepoVersion string `json:"repoVersion,omitempty"`
+	Reason      string `json:"reason"`
+	// Deps lists the changed build dependencies when the reason is dependency.
+	Deps []string `json:"deps,omitempty"`
+}
+
+// repoEntry returns the index entry of the first package of the spec found in the index.
+func (s *Spec) repoEntry(index Index) (IndexEntry, bool) {
+	for _, p := range s.Packages {
+		if entry, ok := index.Lookup(p.Name); ok {
+			return entry, true
+		}
+	}
+	return IndexEntry{}, false
+}
+
+// Outdated compares specs with the repo index. A spec is outdated when none of its packages
+// are in the index, when its version and release are newer than those in the index, or when
+// it must be rebuilt because a build dependency changed. A build dependency has changed when
+// the spec producing it is outdated, or when its version in the index differs from the version
+// the spec's packages were built with. The results follow the order of specs.
+func Outdated(specs []*Spec, index Index) []OutdatedSpec {
+	provider := make(map[string]int)
+	for i, spec := range specs {
+		for _, p := range spec.Packages {
+			provider[p.Name] = i
+		}
+	}
+	versions := index.Versions()
+	outdated := make(map[int]*OutdatedSpec)
+	for i, spec := range specs {
+		result := OutdatedSpec{
+			Spec:    spec.Name,
+			Path:    spec.path,
+			Version: fmt.Sprintf("%s-%d", spec.Version, spec.Release),
+		}
+		entry, ok := spec.repoEntry(index)
+		switch {
+		case !ok:
+			result.Reason = ReasonNew
+		case compareFullVersions(spec.Version, spec.Release, entry.Version, entry.Release) > 0:
+			result.RepoVersion = entry.FullVersion()
+			result.Reason = ReasonNewer
+		default:
+			continue
+		}
+		outdated[i] = &result
+	}
+
+	// Rebuilding a spec changes the packages of the specs depending on it, repeat until
+	// no further specs are affected.
+	for changed := true; changed; {
+		changed = false
+		for i, spec := range specs {
+			if outdated[i] != nil {
+				continue
+			}
+			entry, _ := spec.repoEntry(index)
+			var deps []string
+			for _, dep := range strings.Fields(spec.BuildDeps) {
+				j, produced := provider[dep]
+				builtWith, recorded := entry.BuiltWith[dep]
+				if (produced && j != i && outdated[j] != nil) || (recorded && builtWith != versions[dep]) {
+					deps = append(deps, dep)
+				}
+			}
+			if len(deps) == 0 {
+				continue
+			}
+			sort.Strings(deps)
+			outdated[i] = &OutdatedSpec{
+				Spec:        spec.Name,
+				Path:        spec.path,
+				Version:     fmt.Sprintf("%s-%d", spec.Version, spec.Release),
+				RepoVersion: entry.FullVersion(),
+				Reason:      ReasonDependency,
+				Deps:        deps,
+			}
+			changed = true
+		}
+	}
+
+	results := make([]OutdatedSpec, 0, len(outdated))
+	for i := range specs {
+		if outdated[i] != nil {
+			results = append(results, *outdated[i])
+		}
+	}
+	return results
+}
@@ -0,0 +1,57 @@
+package mere
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutdated(t *testing.T) {
+	t.Parallel()
+	specs := []*Spec{
+		{Name: "base", path: "base.yaml", Version: "1.1", Release: 1, Packages: []Package{{Name: "base"}}},
+		{Name: "lib", path: "lib.yaml", Version: "2.0", Release: 1, BuildDeps: "base", Packages: []Package{{Name: "lib"}}},
+		{Name: "app", path: "app.yaml", Version: "3.0", Release: 1, BuildDeps: "lib", Packages: []Package{{Name: "app"}}},
+		{Name: "tool", path: "tool.yaml", Version: "1.0", Release: 2, BuildDeps: "zlib", Packages: []Package{{Name: "tool"}}},
+		{Name: "zlib", path: "zlib.yaml", Version: "1.3", Release: 1, Packages: []Package{{Name: "zlib"}}},
+		{Name: "fresh", path: "fresh.yaml", Version: "0.1", Release: 1, Packages: []Package{{Name: "fresh"}}},
+		{Name: "old", path: "old.yaml", Version: "1.0", Release: 1, Packages: []Package{{Name: "old"}}},
+	}
+	index := Index{Packages: []IndexEntry{
+		{Name: "app", Version: "3.0", Release: 1, BuiltWith: map[string]string{"lib": "2.0-1"}},
+		{Name: "base", Version: "1.0", Release: 1},
+		{Name: "lib", Version: "2.0", Release: 1, BuiltWith: map[string]string{"base": "1.0-1"}},
+		{Name: "old", Version: "1.1", Release: 1},
+		{Name: "tool", Version: "1.0", Release: 1},
+		{Name: "zlib", Version: "1.3", Release: 1},
+	}}
+	t.Run("Should report newer, new and reverse dependency rebuilds", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []OutdatedSpec{
+			{Spec: "base", Path: "base.yaml", Version: "1.1-1", RepoVersion: "1.0-1", Reason: ReasonNewer},
+			{
+				Spec: "lib", Path: "lib.yaml", Version: "2.0-1", RepoVersion: "2.0-1",
+				Reason: ReasonDependency, Deps: []string{"base"},
+			},
+			{
+				Spec: "app", Path: "app.yaml", Version: "3.0-1", RepoVersion: "3.0-1",
+				Reason: ReasonDependency, Deps: []string{"lib"},
+			},
+			{Spec: "tool", Path: "tool.yaml", Version: "1.0-2", RepoVersion: "1.0-1", Reason: ReasonNewer},
+			{Spec: "fresh", Path: "fresh.yaml", Version: "0.1-1", Reason: ReasonNew},
+		}, Outdated(specs, index))
+	})
+	t.Run("Should report specs built with a different version of a dependency", func(t *testing.T) {
+		t.Parallel()
+		index := Index{Packages: []IndexEntry{
+			{Name: "zlib", Version: "1.3", Release: 2},
+			{Name: "tool", Version: "1.0", Release: 2, BuiltWith: map[string]string{"zlib": "1.3-1"}},
+		}}
+		assert.Equal(t, []OutdatedSpec{
+			{
+				Spec: "tool", Path: "tool.yaml", Version: "1.0-2", RepoVersion: "1.0-2",
+				Reason: ReasonDependency, Deps: []string{"zlib"},
+			},
+		}, Outdated(specs[3:5], index))
+	})
+}
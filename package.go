@@ -0,0 +1,361 @@
+package mere
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	manifestName = ".MANIFEST"
+	archiveExt   = ".tar.gz"
+	manifestPerm = 0o644
+	fileType     = "file"
+	dirType      = "dir"
+	symlinkType  = "symlink"
+	charType     = "char"
+	blockType    = "block"
+	fifoType     = "fifo"
+)
+
+var errNotBuilt = errors.New("spec has not been built")
+
+// ManifestFile describes a single entry in a package archive.
+type ManifestFile struct {
+	Path  string `json:"path" jsonschema:"example=usr/bin/ldd" jsonschema_description:"Path of the file, relative to the root"`
+	Type  string `json:"type" jsonschema:"enum=file,enum=dir,enum=symlink,enum=char,enum=block,enum=fifo"`
+	Mode  uint32 `json:"mode" jsonschema_description:"Permission bits of the file"`
+	UID   int    `json:"uid" jsonschema:"minimum=0"`
+	GID   int    `json:"gid" jsonschema:"minimum=0"`
+	Size  int64  `json:"size,omitempty" jsonschema:"minimum=0" jsonschema_description:"Size of a regular file in bytes"`
+	B3Sum string `json:"b3sum,omitempty" jsonschema:"pattern=^[0-9a-f]{64}$" jsonschema_description:"BLAKE3 sum of a regular file in hex"`
+	Link  string `json:"link,omitempty" jsonschema_description:"Target of a symlink"`
+	// Major and Minor are the device numbers of char and block devices.
+	Major int64 `json:"major,omitempty" jsonschema:"minimum=0" jsonschema_description:"Major device number of a char or block device"`
+	Minor int64 `json:"minor,omitempty" jsonschema:"minimum=0" jsonschema_description:"Minor device number of a char or block device"`
+}
+
+// Manifest describes a package and the contents of its archive. It is stored as the
+// first entry of every package archive.
+type Manifest struct {
+	Name        string   `json:"name" jsonschema:"pattern=^[a-z0-9][a-z0-9+._-]*$" jsonschema_description:"Name of the package"`
+	Version     string   `json:"version" jsonschema_description:"Version of the spec the package was built from"`
+	Release     int64    `json:"release" jsonschema:"minimum=1" jsonschema_description:"Release of the spec the package was built from"`
+	Description string   `json:"description,omitempty"`
+	Deps        []string `json:"deps,omitempty" jsonschema_description:"Packages needed at runtime"`
+	Libs        []string `json:"libs,omitempty" jsonschema_description:"Shared libraries provided by the package"`
+	// BuiltWith holds the versions of the build dependencies the package was built with, by name.
+	BuiltWith map[string]string `json:"builtWith,omitempty" jsonschema_description:"Versions of the build dependencies the package was built with, by name"`
+	Files     []ManifestFile    `json:"files" jsonschema_description:"Every entry of the archive other than the manifest, in lexical order"`
+}
+
+// Artifact is a package archive created from a build.
+type Artifact struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"`
+	B3Sum    string   `json:"b3sum"`
+	Manifest Manifest `json:"manifest"`
+}
+
+// archiveName returns the file name of the archive for the named package.
+func (s *Spec) archiveName(name string) string {
+	return fmt.Sprintf("%s-%s-%d%s", name, s.Version, s.Release, archiveExt)
+}
+
+// pkgdirEntries returns the relative path of every entry in the package directory, in lexical order.
+func pkgdirEntries(pkgdir string) ([]string, error) {
+	var entries []string
+	err := filepath.WalkDir(pkgdir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != pkgdir {
+			rel, _ := filepath.Rel(pkgdir, path)
+			entries = append(entries, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return entries, nil
+}
+
+// assignFiles maps each entry of the package directory to the index of the first package whose
+// files globs match it, or any of its parent directories. A package without any files receives
+// every entry not claimed by another package.
+func (s *Spec) assignFiles(pkgdir string, entries []string) map[int][]string {
+	owner := make(map[string]int, len(entries))
+	for i, p := range s.Packages {
+		for _, pattern := range p.Files {
+			matches, _ := filepath.Glob(filepath.Join(pkgdir, strings.TrimPrefix(pattern, "/")))
+			if len(matches) == 0 {
+				s.log.Warn(fmt.Sprintf("Package %s: no files match %s", p.Name, pattern))
+			}
+			for _, match := range matches {
+				rel, _ := filepath.Rel(pkgdir, match)
+				for _, entry := range entries {
+					if entry == rel || strings.HasPrefix(entry, rel+"/") {
+						if _, ok := owner[entry]; !ok {
+							owner[entry] = i
+						}
+					}
+				}
+			}
+		}
+	}
+	remainder := -1
+	for i, p := range s.Packages {
+		if len(p.Files) == 0 {
+			remainder = i
+			break
+		}
+	}
+	assigned := make(map[int][]string)
+	for _, entry := range entries {
+		i, ok := owner[entry]
+		if !ok {
+			info, err := os.Lstat(filepath.Join(pkgdir, entry))
+			if err != nil || info.IsDir() {
+				continue
+			}
+			if remainder < 0 {
+				s.log.Warn("Not included in any package: " + entry)
+				continue
+			}
+			i = remainder
+		}
+		assigned[i] = append(assigned[i], entry)
+	}
+	// Include the parent directories of every entry, so their modes are recorded.
+	for i, files := range assigned {
+		set := make(map[string]bool, len(files))
+		for _, file := range files {
+			set[file] = true
+			for dir := filepath.Dir(file); dir != "."; dir = filepath.Dir(dir) {
+				set[dir] = true
+			}
+		}
+		files = files[:0]
+		for file := range set {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		assigned[i] = files
+	}
+	return assigned
+}
+
+// normalizeHeader removes details from a tar header which vary between otherwise identical builds.
+// Files of the user running the build are recorded as owned by root, whoever that user is. In a
+// fakeroot build, other owners are recorded as the ids they had inside of the user namespace.
+func (s *Spec) normalizeHeader(header *tar.Header) {
+	epoch := time.Unix(s.sourceDateEpoch, 0)
+	if header.ModTime.After(epoch) {
+		header.ModTime = epoch
+	}
+	header.ModTime = header.ModTime.Truncate(time.Second)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	switch {
+	case s.fakeroot:
+		header.Uid = containerID(s.uidMap, header.Uid)
+		header.Gid = containerID(s.gidMap, header.Gid)
+	default:
+		if header.Uid == s.buildUID {
+			header.Uid = 0
+		}
+		if header.Gid == s.buildGID {
+			header.Gid = 0
+		}
+	}
+	header.Uname = ""
+	header.Gname = ""
+	header.PAXRecords = nil
+	header.Format = tar.FormatUnknown
+}
+
+// manifestFile creates the manifest entry for a tar header, hashing the file contents if needed.
+func manifestFile(header *tar.Header, path string) (ManifestFile, error) {
+	file := ManifestFile{
+		Path: strings.TrimSuffix(header.Name, "/"),
+		Mode: uint32(header.Mode), //nolint:gosec // tar modes are at most 0o7777 and the file type
+		UID:  header.Uid,
+		GID:  header.Gid,
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		file.Type = dirType
+	case tar.TypeSymlink:
+		file.Type = symlinkType
+		file.Link = header.Linkname
+	case tar.TypeChar, tar.TypeBlock:
+		file.Type = charType
+		if header.Typeflag == tar.TypeBlock {
+			file.Type = blockType
+		}
+		file.Major = header.Devmajor
+		file.Minor = header.Devminor
+	case tar.TypeFifo:
+		file.Type = fifoType
+	default:
+		file.Type = fileType
+		file.Size = header.Size
+		sum, err := computeB3SumFromFile(path)
+		if err != nil {
+			return file, err
+		}
+		file.B3Sum = sum
+	}
+	return file, nil
+}
+
+// builtWith returns the known versions of the spec's build dependencies, by name.
+func (s *Spec) builtWith() map[string]string {
+	var versions map[string]string
+	for _, dep := range strings.Fields(s.BuildDeps) {
+		if version, ok := s.depVersions[dep]; ok {
+			if versions == nil {
+				versions = make(map[string]string)
+			}
+			versions[dep] = version
+		}
+	}
+	return versions
+}
+
+// writeArchive writes a deterministic gzip compressed tar archive to dest, containing the
+// manifest followed by the given entries of the package directory in lexical order.
+func (s *Spec) writeArchive(dest string, pkgdir string, p Package, entries []string) (Manifest, error) {
+	manifest := Manifest{
+		Name:        p.Name,
+		Version:     s.Version,
+		Release:     s.Release,
+		Description: s.Description,
+		Deps:        p.Deps,
+		Libs:        p.Libs,
+		BuiltWith:   s.builtWith(),
+		Files:       make([]ManifestFile, 0, len(entries)),
+	}
+	headers := make([]*tar.Header, 0, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(pkgdir, entry)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return manifest, fmt.Errorf("%w", err)
+		}
+		link, _ := os.Readlink(path)
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return manifest, fmt.Errorf("%w", err)
+		}
+		header.Name = filepath.ToSlash(entry)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		s.normalizeHeader(header)
+		file, err := manifestFile(header, path)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, file)
+		headers = append(headers, header)
+	}
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return manifest, fmt.Errorf("%w", err)
+	}
+	defer f.Close()
+	gw, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+	tw := tar.NewWriter(gw)
+	manifestHeader := &tar.Header{
+		Name:     manifestName,
+		Typeflag: tar.TypeReg,
+		Mode:     manifestPerm,
+		Size:     int64(len(data)),
+		ModTime:  time.Unix(s.sourceDateEpoch, 0),
+	}
+	if err := writeTarEntry(tw, manifestHeader, bytes.NewReader(data)); err != nil {
+		return manifest, err
+	}
+	for i, header := range headers {
+		if err := s.writePkgdirEntry(tw, header, filepath.Join(pkgdir, entries[i])); err != nil {
+			return manifest, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return manifest, fmt.Errorf("%w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return manifest, fmt.Errorf("%w", err)
+	}
+	return manifest, nil
+}
+
+func (s *Spec) writePkgdirEntry(tw *tar.Writer, header *tar.Header, path string) error {
+	if header.Typeflag != tar.TypeReg {
+		return writeTarEntry(tw, header, nil)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer f.Close()
+	return writeTarEntry(tw, header, f)
+}
+
+func writeTarEntry(tw *tar.Writer, header *tar.Header, r io.Reader) error {
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if r != nil {
+		if _, err := io.Copy(tw, r); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+	return nil
+}
+
+// CreatePackages splits the contents of the package directory into an archive for each
+// package defined in the spec, writing them to dir. It must be called after BuildSteps.
+func (s *Spec) CreatePackages(dir string) ([]Artifact, error) {
+	if s.workingDir == "" {
+		return nil, fmt.Errorf("%w", errNotBuilt)
+	}
+	if err := ensureDir(os.MkdirAll, dir); err != nil {
+		return nil, err
+	}
+	pkgdir := filepath.Join(s.workingDir, pkg)
+	entries, err := pkgdirEntries(pkgdir)
+	if err != nil {
+		return nil, err
+	}
+	assigned := s.assignFiles(pkgdir, entries)
+	artifacts := make([]Artifact, 0, len(s.Packages))
+	for i, p := range s.Packages {
+		dest := filepath.Join(dir, s.archiveName(p.Name))
+		s.log.Info("Creating package " + dest)
+		manifest, err := s.writeArchive(dest, pkgdir, p, assigned[i])
+		if err != nil {
+			return artifacts, err
+		}
+		sum, err := computeB3SumFromFile(dest)
+		if err != nil {
+			return artifacts, err
+		}
+		artifacts = append(artifacts, Artifact{Name: p.Name, Path: dest, B3Sum: sum, Manifest: manifest})
+	}
+	return artifacts, nil
+}
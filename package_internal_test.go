@@ -0,0 +1,141 @@
+package mere
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildPackages(t *testing.T, filename string) (*Spec, []Artifact, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	spec, err := NewSpec(filename, WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf))
+	require.NoError(t, err)
+	require.NoError(t, spec.BuildSteps(context.Background()))
+	t.Cleanup(spec.Cleanup)
+	artifacts, err := spec.CreatePackages(t.TempDir())
+	require.NoError(t, err)
+	return spec, artifacts, &buf
+}
+
+func TestCreatePackages(t *testing.T) {
+	t.Parallel()
+	t.Run("Should split the package directory into archives", func(t *testing.T) {
+		t.Parallel()
+		_, artifacts, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		require.Len(t, artifacts, 2)
+		assert.Equal(t, "hello-1.0-1.tar.gz", filepath.Base(artifacts[0].Path))
+		assert.Equal(t, []string{"musl"}, artifacts[0].Manifest.Deps)
+
+		var paths []string
+		for _, file := range artifacts[0].Manifest.Files {
+			paths = append(paths, file.Path)
+		}
+		assert.Equal(t, []string{"bin", "bin/hello", "bin/hi"}, paths)
+		assert.Equal(t, fileType, artifacts[0].Manifest.Files[1].Type)
+		assert.Equal(t, uint32(0o755), artifacts[0].Manifest.Files[1].Mode)
+		assert.Equal(t, "hello", artifacts[0].Manifest.Files[2].Link)
+
+		paths = nil
+		for _, file := range artifacts[1].Manifest.Files {
+			paths = append(paths, file.Path)
+		}
+		assert.Equal(t, []string{"share", "share/doc", "share/doc/README"}, paths)
+	})
+	t.Run("Should normalize archive metadata", func(t *testing.T) {
+		t.Parallel()
+		_, artifacts, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		var names []string
+		err := walkTar(artifacts[0].Path, func(header *tar.Header, _ io.Reader) error {
+			names = append(names, header.Name)
+			assert.Equal(t, time.Unix(1600000000, 0).UTC(), header.ModTime.UTC())
+			assert.Equal(t, 0, header.Uid)
+			assert.Empty(t, header.Uname)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{manifestName, "bin/", "bin/hello", "bin/hi"}, names)
+	})
+	t.Run("Should record the files of the build user as owned by root without fakeroot", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_packages.yaml", WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf))
+		require.NoError(t, err)
+		require.NoError(t, spec.BuildSteps(context.Background()))
+		defer spec.Cleanup()
+		if os.Geteuid() == 0 {
+			// Build as an unprivileged user would, owning every file of the package directory.
+			spec.buildUID, spec.buildGID = 4242, 4343
+			err := filepath.Walk(filepath.Join(spec.workingDir, pkg), func(path string, _ os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				return os.Lchown(path, spec.buildUID, spec.buildGID)
+			})
+			require.NoError(t, err)
+		}
+		artifacts, err := spec.CreatePackages(t.TempDir())
+		require.NoError(t, err)
+		for _, artifact := range artifacts {
+			for _, file := range artifact.Manifest.Files {
+				assert.Equal(t, [2]int{0, 0}, [2]int{file.UID, file.GID}, file.Path)
+			}
+		}
+	})
+	t.Run("Should produce identical archives from identical package directories", func(t *testing.T) {
+		t.Parallel()
+		_, first, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		_, second, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		assert.Equal(t, first[0].B3Sum, second[0].B3Sum)
+		assert.Equal(t, first[1].B3Sum, second[1].B3Sum)
+	})
+	t.Run("Should warn about globs which match nothing and unpackaged files", func(t *testing.T) {
+		t.Parallel()
+		_, _, buf := buildPackages(t, "testdata/spec_no_sources.yaml")
+		assert.Contains(t, buf.String(), "warning: Package musl: no files match bin/ldd")
+	})
+	t.Run("Should fail if the spec has not been built", func(t *testing.T) {
+		t.Parallel()
+		spec, err := NewSpec("testdata/spec_with_packages.yaml", WithLogger(Log{Output: io.Discard}))
+		require.NoError(t, err)
+		_, err = spec.CreatePackages(t.TempDir())
+		require.EqualError(t, err, "spec has not been built")
+	})
+	t.Run("Should fail if the output directory cannot be created", func(t *testing.T) {
+		t.Parallel()
+		spec, _, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		_, err := spec.CreatePackages("/dev/null/out")
+		require.Error(t, err)
+	})
+}
+
+func Test_resolveSourceDateEpoch(t *testing.T) {
+	t.Parallel()
+	t.Run("Should derive the epoch from the first source archive", func(t *testing.T) {
+		t.Parallel()
+		spec, err := NewSpec("testdata/spec_local_file.yaml",
+			WithLogger(Log{Output: io.Discard}), WithSourceCache(t.TempDir()))
+		require.NoError(t, err)
+		require.Empty(t, spec.fetchSources(context.Background()))
+		newest, err := newestModTime("testdata/testarchive.tar.gz")
+		require.NoError(t, err)
+		assert.Equal(t, newest.Unix(), spec.resolveSourceDateEpoch())
+		spec.SourceDateEpoch = 1
+		assert.Equal(t, int64(1), spec.resolveSourceDateEpoch())
+	})
+	t.Run("Should be provided to build stages", func(t *testing.T) {
+		t.Parallel()
+		spec, _, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		data, err := os.ReadFile(filepath.Join(spec.workingDir, pkg, "share/doc/README"))
+		require.NoError(t, err)
+		assert.Equal(t, "built at 1600000000\n", string(data))
+	})
+}
@@ -0,0 +1,292 @@
+package mere
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var (
+	yamlErrorLine     = regexp.MustCompile(`^yaml: line (\d+): `)
+	templateErrorLine = regexp.MustCompile(`^template: [^:]*:(\d+)(?::(\d+))?: `)
+)
+
+// FieldError is an error found at a line and column of a spec file.
+type FieldError struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	// Field is the path of the field in error, such as sources.0.url, empty for the whole spec.
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error formats the error as file:line:column: field: message, which editors understand.
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", e.File, e.Line, e.Column, e.Field, e.Message)
+}
+
+// SpecErrors holds every error found while validating a spec file, one per line. It matches
+// errors.Is for the kinds of errors it holds, such as an invalid schema or a failure to render
+// a template.
+type SpecErrors struct {
+	Errors []FieldError
+	kinds  []error
+}
+
+func (e *SpecErrors) Error() string {
+	lines := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		lines = append(lines, err.Error())
+	}
+	return fmt.Sprintf("%s:\n%s", errValidate, strings.Join(lines, "\n"))
+}
+
+func (e *SpecErrors) Unwrap() []error {
+	return append([]error{errValidate}, e.kinds...)
+}
+
+// add records an error of the given kind, which may be nil.
+func (e *SpecErrors) add(kind error, err FieldError) {
+	e.Errors = append(e.Errors, err)
+	if kind != nil && !errors.Is(e, kind) {
+		e.kinds = append(e.kinds, kind)
+	}
+}
+
+// has reports whether an error was recorded for the field.
+func (e *SpecErrors) has(field string) bool {
+	for _, err := range e.Errors {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// orNil returns nil when no errors were recorded, and otherwise sorts the errors by their
+// position in the spec file.
+func (e *SpecErrors) orNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	sort.SliceStable(e.Errors, func(i, j int) bool {
+		a, b := e.Errors[i], e.Errors[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return e
+}
+
+// mappingValue returns the value node of key in a mapping node, or nil.
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// childNode returns the value of key in a mapping node, or the element at the index key of a
+// sequence node.
+func childNode(node *yamlv3.Node, key string) *yamlv3.Node {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		return mappingValue(node, key)
+	case yamlv3.SequenceNode:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// lookupNode returns the node at path, such as sources.0.url, or the closest parent of it
+// which exists along with false.
+func lookupNode(root *yamlv3.Node, path string) (*yamlv3.Node, bool) {
+	node := root
+	if path == "" {
+		return node, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		next := childNode(node, key)
+		if next == nil {
+			return node, false
+		}
+		node = next
+	}
+	return node, true
+}
+
+// specLocator finds the positions of the fields of a spec file.
+type specLocator struct {
+	path  string
+	root  *yamlv3.Node
+	lines []string
+}
+
+// newSpecLocator parses the spec file at path holding data. A file which is not valid YAML
+// results in an error positioned at the line reported by the parser. As the parser reports the
+// line of the enclosing block rather than the line in error, the first line whose indentation
+// does not fit the blocks from there on is taken instead when there is one.
+func newSpecLocator(path string, data []byte) (*specLocator, *FieldError) {
+	l := &specLocator{
+		path:  path,
+		root:  &yamlv3.Node{Line: 1, Column: 1},
+		lines: strings.Split(string(data), "\n"),
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		fe := &FieldError{File: path, Line: 1, Column: 1, Message: err.Error()}
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			fe.Line, _ = strconv.Atoi(m[1])
+			fe.Message = strings.TrimPrefix(err.Error(), m[0])
+			if line, column, ok := l.indentationBreak(fe.Line); ok {
+				fe.Line, fe.Column = line, column
+			}
+		}
+		return l, fe
+	}
+	if len(doc.Content) > 0 {
+		l.root = doc.Content[0]
+	}
+	return l, nil
+}
+
+// indentationBreak returns the position of the first line, starting at line from, which is
+// indented deeper than the line before it without that line opening a block, or which is not
+// indented as any of the enclosing blocks. The blocks are followed from the start of the file.
+func (l *specLocator) indentationBreak(from int) (int, int, bool) {
+	var levels []int
+	opens := true
+	// scalar is the indentation of the key of a block scalar whose lines are skipped.
+	scalar := -1
+	for i := range l.lines {
+		text, _, _ := strings.Cut(l.lines[i], " #")
+		content := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(content) == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		indent := len(text) - len(content)
+		if scalar >= 0 && indent > scalar {
+			continue
+		}
+		scalar = -1
+		for len(levels) > 0 && levels[len(levels)-1] > indent {
+			levels = levels[:len(levels)-1]
+		}
+		switch top := len(levels) - 1; {
+		case top < 0 || levels[top] < indent:
+			if !opens && i+1 >= from {
+				return i + 1, indent + 1, true
+			}
+			levels = append(levels, indent)
+		case levels[top] != indent:
+			if i+1 >= from {
+				return i + 1, indent + 1, true
+			}
+			levels = append(levels, indent)
+		}
+		// The content of a sequence item is a block of its own.
+		for strings.HasPrefix(content, "- ") {
+			indent += 2
+			content = strings.TrimLeft(content[2:], " ")
+			levels = append(levels, indent)
+		}
+		content = strings.TrimSpace(content)
+		opens = strings.HasSuffix(content, ":") || content == "-"
+		if _, indicator, ok := strings.Cut(content, ": "); ok && strings.ContainsAny(indicator, "|>") &&
+			strings.Trim(indicator, "|>+-0123456789") == "" {
+			scalar = indent
+		}
+	}
+	return 0, 0, false
+}
+
+// fieldError returns an error positioned at the field, or at its closest parent which exists.
+func (l *specLocator) fieldError(field, format string, args ...any) FieldError {
+	node, _ := lookupNode(l.root, field)
+	return FieldError{
+		File:    l.path,
+		Line:    node.Line,
+		Column:  node.Column,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// blockIndent returns the indentation of the block scalar whose indicator is on line.
+func (l *specLocator) blockIndent(line int) int {
+	for _, text := range l.lines[min(line, len(l.lines)):] {
+		if strings.TrimSpace(text) != "" {
+			return len(text) - len(strings.TrimLeft(text, " "))
+		}
+	}
+	return 0
+}
+
+// templateError positions an error from rendering the template in field at the line and
+// column of the template within the spec file.
+func (l *specLocator) templateError(field string, err error) FieldError {
+	msg := err.Error()
+	m := templateErrorLine.FindStringSubmatch(msg)
+	if m == nil {
+		return l.fieldError(field, "%s", msg)
+	}
+	fe := l.fieldError(field, "%s", strings.TrimPrefix(msg, m[0]))
+	node, ok := lookupNode(l.root, field)
+	if !ok || node.Kind != yamlv3.ScalarNode {
+		return fe
+	}
+	// Template positions count lines from 1 and columns from 0.
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	switch {
+	case node.Style == yamlv3.LiteralStyle || node.Style == yamlv3.FoldedStyle:
+		// The contents of a block start on the line after its indicator, indented as much
+		// as its first line.
+		fe.Line = node.Line + line
+		fe.Column = l.blockIndent(node.Line) + col + 1
+	case line == 1:
+		fe.Column = node.Column + col
+		if node.Style == yamlv3.DoubleQuotedStyle || node.Style == yamlv3.SingleQuotedStyle {
+			fe.Column++
+		}
+	default:
+		fe.Line = node.Line + line - 1
+		fe.Column = col + 1
+	}
+	return fe
+}
+
+// schemaErrors validates the JSON form of a spec file against the schema of Spec.
+func (l *specLocator) schemaErrors(jsondata []byte) ([]FieldError, error) {
+	result, err := gojsonschema.Validate(specSchema(), gojsonschema.NewBytesLoader(jsondata))
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	errs := make([]FieldError, 0, len(result.Errors()))
+	for _, e := range result.Errors() {
+		field := e.Field()
+		if field == gojsonschema.STRING_CONTEXT_ROOT {
+			field = ""
+		}
+		errs = append(errs, l.fieldError(field, "%s", e.Description()))
+	}
+	return errs, nil
+}
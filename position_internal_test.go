@@ -0,0 +1,110 @@
+package mere
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpecFieldErrors(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	_, err := NewSpec("testdata/spec_with_many_errors.yaml", WithLogger(Log{Output: &buf}))
+	var errs *SpecErrors
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, []FieldError{
+		{
+			File: "testdata/spec_with_many_errors.yaml", Line: 7, Column: 32, Field: "sources.0.url",
+			Message: `executing "" at <.Nam>: can't evaluate field Nam in type *mere.Spec`,
+		},
+		{
+			File: "testdata/spec_with_many_errors.yaml", Line: 9, Column: 10, Field: "sources.1.url",
+			Message: "invalid source definition: unsupported protocol scheme: ftp",
+		},
+		{
+			File: "testdata/spec_with_many_errors.yaml", Line: 15, Column: 28, Field: "build",
+			Message: `executing "" at <.Destdir>: can't evaluate field Destdir in type *mere.Spec`,
+		},
+	}, errs.Errors)
+	require.ErrorIs(t, err, errValidate)
+	require.ErrorIs(t, err, errRender)
+	require.ErrorIs(t, err, errSource)
+	assert.False(t, errors.Is(err, errUpstream))
+	assert.Equal(t, "invalid spec file:\n"+
+		"testdata/spec_with_many_errors.yaml:7:32: sources.0.url: "+
+		`executing "" at <.Nam>: can't evaluate field Nam in type *mere.Spec`+"\n"+
+		"testdata/spec_with_many_errors.yaml:9:10: sources.1.url: "+
+		"invalid source definition: unsupported protocol scheme: ftp\n"+
+		"testdata/spec_with_many_errors.yaml:15:28: build: "+
+		`executing "" at <.Destdir>: can't evaluate field Destdir in type *mere.Spec`, err.Error())
+}
+
+func Test_templateError(t *testing.T) {
+	t.Parallel()
+	data := []byte("plain: a {{.X}}\nquoted: 'b {{.X}}'\nblock: |\n  one\n    two {{.X}}\nempty: \"\"\n")
+	nodes, yamlErr := newSpecLocator("spec.yaml", data)
+	require.Nil(t, yamlErr)
+	tests := []struct {
+		field  string
+		err    string
+		line   int
+		column int
+	}{
+		{field: "plain", err: "template: :1:4: executing", line: 1, column: 12},
+		{field: "quoted", err: "template: :1:4: executing", line: 2, column: 14},
+		{field: "block", err: "template: :2:8: executing", line: 5, column: 11},
+		{field: "block", err: "template: :2: unexpected", line: 5, column: 3},
+		{field: "missing", err: "template: :1:1: executing", line: 1, column: 1},
+		{field: "empty", err: "something else", line: 6, column: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field+" "+tt.err, func(t *testing.T) {
+			t.Parallel()
+			fe := nodes.templateError(tt.field, errors.New(tt.err))
+			assert.Equal(t, tt.line, fe.Line)
+			assert.Equal(t, tt.column, fe.Column)
+			assert.Equal(t, tt.field, fe.Field)
+		})
+	}
+}
+
+func Test_newSpecLocatorYAMLErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		data   string
+		line   int
+		column int
+	}{
+		{
+			name:   "Should find an item indented less than its siblings",
+			data:   "name: hello\nsources:\n  - url: https://example.com\n   b3sum: abc\n",
+			line:   4,
+			column: 4,
+		},
+		{
+			name:   "Should find a key indented deeper than its siblings",
+			data:   "name: hello\nbuild: |\n  make\n\n  make install\nenv:\n  CC: cc\n    CFLAGS: -O2\n",
+			line:   8,
+			column: 5,
+		},
+		{
+			name:   "Should keep the parser's line without an indentation break",
+			data:   "This is invalid YAML:\n1\n",
+			line:   2,
+			column: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, fe := newSpecLocator("spec.yaml", []byte(tt.data))
+			require.NotNil(t, fe)
+			assert.Equal(t, tt.line, fe.Line, fe.Message)
+			assert.Equal(t, tt.column, fe.Column, fe.Message)
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package mere
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	indexFile = "index.json"
+	depsDir   = "deps"
+	repoDir   = "/repo"
+)
+
+var errUnsafePath = errors.New("unsafe path in package archive")
+
+// IndexEntry describes a single package in a repo.
+type IndexEntry struct {
+	Name        string   `json:"name" jsonschema:"pattern=^[a-z0-9][a-z0-9+._-]*$" jsonschema_description:"Name of the package"`
+	Version     string   `json:"version"`
+	Release     int64    `json:"release" jsonschema:"minimum=1"`
+	Description string   `json:"description,omitempty"`
+	Deps        []string `json:"deps,omitempty" jsonschema_description:"Packages needed at runtime"`
+	// BuiltWith holds the versions of the build dependencies the package was built with, by name.
+	BuiltWith map[string]string `json:"builtWith,omitempty" jsonschema_description:"Versions of the build dependencies the package was built with, by name"`
+	// File is the name of the package archive, relative to the repo.
+	File  string `json:"file" jsonschema:"example=hello-1.2.3-1.tar.gz" jsonschema_description:"Name of the package archive, relative to the repo"`
+	B3Sum string `json:"b3sum" jsonschema:"pattern=^[0-9a-f]{64}$" jsonschema_description:"BLAKE3 sum of the package archive in hex"`
+}
+
+// FullVersion returns the version and release of the package, such as 1.2.3-1.
+func (e IndexEntry) FullVersion() string {
+	return fmt.Sprintf("%s-%d", e.Version, e.Release)
+}
+
+// Index lists the packages available in a repo, sorted by name.
+type Index struct {
+	Packages []IndexEntry `json:"packages" jsonschema_description:"Packages available in the repo, sorted by name"`
+}
+
+// Lookup returns the entry of the named package.
+func (i Index) Lookup(name string) (IndexEntry, bool) {
+	for _, entry := range i.Packages {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return IndexEntry{}, false
+}
+
+// Versions returns the full version of every package in the index, by name.
+func (i Index) Versions() map[string]string {
+	versions := make(map[string]string, len(i.Packages))
+	for _, entry := range i.Packages {
+		versions[entry.Name] = entry.FullVersion()
+	}
+	return versions
+}
+
+// Repo is a local directory of package archives described by an index, into which
+// built packages are added and from which the build dependencies of later builds are installed.
+type Repo struct {
+	Path string
+}
+
+// NewRepo returns a Repo for the configured repo location.
+func NewRepo(opts ...Option) (Repo, error) {
+	o := newOptions(opts)
+	return Repo{Path: o.resolveRepo()}, nil
+}
+
+// Index reads the index of the repo. A repo without an index is empty.
+func (r Repo) Index() (Index, error) {
+	index := Index{Packages: []IndexEntry{}}
+	data, err := os.ReadFile(filepath.Join(r.Path, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return index, fmt.Errorf("%w", err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, fmt.Errorf("%s: %w", indexFile, err)
+	}
+	return index, nil
+}
+
+// Add copies the given package archives into the repo and updates its index, replacing
+// any entries of the same names. Add must not be called concurrently for the same repo.
+func (r Repo) Add(artifacts []Artifact) error {
+	if err := ensureDir(os.MkdirAll, r.Path); err != nil {
+		return err
+	}
+	index, err := r.Index()
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]IndexEntry, len(index.Packages)+len(artifacts))
+	for _, entry := range index.Packages {
+		entries[entry.Name] = entry
+	}
+	for _, artifact := range artifacts {
+		name := filepath.Base(artifact.Path)
+		if err := copyFile(artifact.Path, filepath.Join(r.Path, name)); err != nil {
+			return err
+		}
+		entries[artifact.Name] = IndexEntry{
+			Name:        artifact.Name,
+			Version:     artifact.Manifest.Version,
+			Release:     artifact.Manifest.Release,
+			Description: artifact.Manifest.Description,
+			Deps:        artifact.Manifest.Deps,
+			BuiltWith:   artifact.Manifest.BuiltWith,
+			File:        name,
+			B3Sum:       artifact.B3Sum,
+		}
+	}
+	index.Packages = make([]IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		index.Packages = append(index.Packages, entry)
+	}
+	sort.Slice(index.Packages, func(i, j int) bool { return index.Packages[i].Name < index.Packages[j].Name })
+	return r.writeIndex(index)
+}
+
+// writeIndex replaces the index of the repo, such that readers never see a partial index.
+func (r Repo) writeIndex(index Index) error {
+	data, _ := json.MarshalIndent(index, "", "  ")
+	tmp, err := os.CreateTemp(r.Path, "."+indexFile+"-*")
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if err := os.Chmod(tmp.Name(), manifestPerm); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(r.Path, indexFile)); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// resolve returns the index entries of the named packages and, recursively, of their
+// dependencies. Names which are not in the index are ignored.
+func (i Index) resolve(names []string) []IndexEntry {
+	seen := make(map[string]bool)
+	var resolved []IndexEntry
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		entry, ok := i.Lookup(name)
+		if !ok {
+			return
+		}
+		resolved = append(resolved, entry)
+		for _, dep := range entry.Deps {
+			visit(dep)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return resolved
+}
+
+// install extracts the named packages and their dependencies from the repo into root,
+// returning the entries which were installed.
+func (r Repo) install(names []string, root string) ([]IndexEntry, error) {
+	index, err := r.Index()
+	if err != nil {
+		return nil, err
+	}
+	entries := index.resolve(names)
+	for _, entry := range entries {
+		archive := filepath.Join(r.Path, entry.File)
+		sum, err := computeB3SumFromFile(archive)
+		if err != nil {
+			return nil, err
+		}
+		if sum != entry.B3Sum {
+			return nil, fmt.Errorf("%w: %s", errHash, archive)
+		}
+		if err := extractPackage(archive, root); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// extractPackage extracts the files of a package archive, other than its manifest, into root.
+// Entries are never written through symlinks: entries below a symlink, and symlinks which are
+// absolute or point outside of root, are refused.
+func extractPackage(archive, root string) error {
+	return walkTar(archive, func(header *tar.Header, r io.Reader) error {
+		name := strings.TrimSuffix(header.Name, "/")
+		if name == manifestName {
+			return nil
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("%w: %s", errUnsafePath, header.Name)
+		}
+		if err := checkParents(root, name); err != nil {
+			return err
+		}
+		path := filepath.Join(root, name)
+		if err := ensureDir(os.MkdirAll, filepath.Dir(path)); err != nil {
+			return err
+		}
+		mode := os.FileMode(header.Mode).Perm() //nolint:gosec // tar modes are at most 0o7777
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if isSymlink(path) {
+				return fmt.Errorf("%w: %s is a symlink", errUnsafePath, header.Name)
+			}
+			if err := ensureDir(os.MkdirAll, path); err != nil {
+				return err
+			}
+			return os.Chmod(path, mode) //nolint:wrapcheck // The path is part of the error
+		case tar.TypeSymlink:
+			target := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), target)) {
+				return fmt.Errorf("%w: %s links outside of the root to %s", errUnsafePath, header.Name, header.Linkname)
+			}
+			_ = os.Remove(path)
+			return os.Symlink(header.Linkname, path) //nolint:wrapcheck // The path is part of the error
+		case tar.TypeReg:
+			if isSymlink(path) {
+				// Replace the symlink rather than writing to its target.
+				_ = os.Remove(path)
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return fmt.Errorf("%w", err)
+			}
+			if _, err := io.Copy(f, r); err != nil {
+				f.Close()
+				return fmt.Errorf("%w", err)
+			}
+			return f.Close() //nolint:wrapcheck // The path is part of the error
+		default:
+			// Device nodes and fifos cannot be created without privileges, and are not
+			// needed by builds.
+			return nil
+		}
+	})
+}
+
+// checkParents fails when any parent directory of the local path name below root is a symlink,
+// such that extracting name cannot write outside of root.
+func checkParents(root, name string) error {
+	parent := root
+	dirs := strings.Split(filepath.Dir(name), string(filepath.Separator))
+	for _, dir := range dirs {
+		if dir == "." {
+			break
+		}
+		parent = filepath.Join(parent, dir)
+		if isSymlink(parent) {
+			return fmt.Errorf("%w: %s is below a symlink", errUnsafePath, name)
+		}
+	}
+	return nil
+}
+
+// isSymlink reports whether path exists and is a symlink.
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// installDeps installs the build dependencies of the spec which are available in its repo
+// into the deps directory of the working directory.
+func (s *Spec) installDeps() error {
+	if s.repo == "" {
+		return nil
+	}
+	root := filepath.Join(s.workingDir, depsDir)
+	entries, err := Repo{Path: s.repo}.install(strings.Fields(s.BuildDeps), root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		s.log.Info(fmt.Sprintf("Installed build dependency %s %s", entry.Name, entry.FullVersion()))
+	}
+	return nil
+}
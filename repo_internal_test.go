@@ -0,0 +1,152 @@
+package mere
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePackageArchive writes a gzipped tar archive of the given entries to path, with
+// fileContent as the content of every regular file.
+func writePackageArchive(t *testing.T, path string, headers ...*tar.Header) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(fileContent))
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		if header.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(fileContent))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+const fileContent = "root::0:0::/root:/bin/sh\n"
+
+func Test_extractPackage(t *testing.T) {
+	t.Parallel()
+	symlink := func(name, target string) *tar.Header {
+		return &tar.Header{Name: name, Linkname: target, Typeflag: tar.TypeSymlink, Mode: 0o777}
+	}
+	file := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644}
+	}
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+		// outside is linked as lib in root before extracting when set.
+		outside bool
+		errMsg  string
+	}{
+		{
+			name:    "Should refuse an absolute symlink followed by a file below it",
+			headers: []*tar.Header{symlink("lib", "/"), file("lib/etc/passwd")},
+			errMsg:  "lib links outside of the root to /",
+		},
+		{
+			name:    "Should refuse a relative symlink leaving the root",
+			headers: []*tar.Header{symlink("usr/lib", "../../etc"), file("usr/lib/passwd")},
+			errMsg:  "usr/lib links outside of the root to ../../etc",
+		},
+		{
+			name:    "Should refuse files below a symlink in the root",
+			headers: []*tar.Header{file("lib/passwd")},
+			outside: true,
+			errMsg:  "lib/passwd is below a symlink",
+		},
+		{
+			name:    "Should refuse files below a symlink in the archive",
+			headers: []*tar.Header{file("lib/hello"), symlink("lib64", "lib"), file("lib64/passwd")},
+			errMsg:  "lib64/passwd is below a symlink",
+		},
+		{
+			name:    "Should extract symlinks within the root",
+			headers: []*tar.Header{file("bin/hello"), symlink("bin/hi", "hello"), symlink("sbin/hi", "../bin/hello")},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			archive := filepath.Join(t.TempDir(), "package.tar.gz")
+			writePackageArchive(t, archive, tc.headers...)
+			root, outside := t.TempDir(), t.TempDir()
+			if tc.outside {
+				require.NoError(t, os.Symlink(outside, filepath.Join(root, "lib")))
+			}
+			err := extractPackage(archive, root)
+			if tc.errMsg != "" {
+				require.ErrorIs(t, err, errUnsafePath)
+				assert.ErrorContains(t, err, tc.errMsg)
+				assert.NoFileExists(t, filepath.Join(outside, "passwd"))
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(filepath.Join(root, "sbin/hi"))
+			require.NoError(t, err)
+			assert.Equal(t, fileContent, string(data))
+		})
+	}
+}
+
+func TestRepo(t *testing.T) {
+	t.Parallel()
+	t.Run("Should add packages and install them with their dependencies", func(t *testing.T) {
+		t.Parallel()
+		_, artifacts, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		repo := Repo{Path: t.TempDir()}
+		index, err := repo.Index()
+		require.NoError(t, err)
+		assert.Empty(t, index.Packages)
+
+		require.NoError(t, repo.Add(artifacts))
+		require.NoError(t, repo.Add(artifacts[:1]))
+		index, err = repo.Index()
+		require.NoError(t, err)
+		require.Len(t, index.Packages, 2)
+		entry, ok := index.Lookup("hello")
+		require.True(t, ok)
+		assert.Equal(t, "hello-1.0-1.tar.gz", entry.File)
+		assert.Equal(t, []string{"musl"}, entry.Deps)
+
+		root := t.TempDir()
+		installed, err := repo.install([]string{"hello", "unknown"}, root)
+		require.NoError(t, err)
+		require.Len(t, installed, 1)
+		info, err := os.Stat(filepath.Join(root, "bin/hello"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+		link, err := os.Readlink(filepath.Join(root, "bin/hi"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", link)
+		assert.NoFileExists(t, filepath.Join(root, manifestName))
+	})
+	t.Run("Should refuse to install a modified archive", func(t *testing.T) {
+		t.Parallel()
+		_, artifacts, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		repo := Repo{Path: t.TempDir()}
+		require.NoError(t, repo.Add(artifacts))
+		require.NoError(t, os.WriteFile(filepath.Join(repo.Path, "hello-1.0-1.tar.gz"), []byte("modified"), 0o644))
+		_, err := repo.install([]string{"hello"}, t.TempDir())
+		require.ErrorIs(t, err, errHash)
+	})
+	t.Run("Should fail on an invalid index", func(t *testing.T) {
+		t.Parallel()
+		repo := Repo{Path: t.TempDir()}
+		require.NoError(t, os.WriteFile(filepath.Join(repo.Path, indexFile), []byte("{"), 0o644))
+		_, err := repo.Index()
+		require.ErrorContains(t, err, "index.json: ")
+	})
+}
@@ -0,0 +1,119 @@
+package mere
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var errNotReproducible = errors.New("build is not reproducible")
+
+// ReproResult compares the archives of a single package from two builds of the same spec.
+type ReproResult struct {
+	Name   string    `json:"name"`
+	B3Sums [2]string `json:"b3sums"`
+	// Differences lists the archive entries whose contents or metadata differ between the builds.
+	Differences []string `json:"differences,omitempty"`
+}
+
+// Reproducible reports whether both archives are identical.
+func (r ReproResult) Reproducible() bool {
+	return r.B3Sums[0] == r.B3Sums[1]
+}
+
+// archiveDigests returns a description of every entry in a package archive, keyed by its name.
+func archiveDigests(path string) (map[string]string, error) {
+	digests := make(map[string]string)
+	err := walkTar(path, func(header *tar.Header, r io.Reader) error {
+		sum, err := computeB3Sum(r)
+		if err != nil {
+			return err
+		}
+		digests[header.Name] = fmt.Sprintf("%c %o %d:%d %d %s %s",
+			header.Typeflag, header.Mode, header.Uid, header.Gid, header.ModTime.Unix(), header.Linkname, sum)
+		return nil
+	})
+	return digests, err
+}
+
+// compareArchives returns the names of entries which differ between two package archives.
+func compareArchives(a, b string) ([]string, error) {
+	first, err := archiveDigests(a)
+	if err != nil {
+		return nil, err
+	}
+	second, err := archiveDigests(b)
+	if err != nil {
+		return nil, err
+	}
+	var differences []string
+	for name, digest := range first {
+		if second[name] != digest {
+			differences = append(differences, name)
+		}
+	}
+	for name := range second {
+		if _, ok := first[name]; !ok {
+			differences = append(differences, name)
+		}
+	}
+	sort.Strings(differences)
+	return differences, nil
+}
+
+// buildOnce builds the spec at path and creates its packages in a new temporary directory,
+// which the caller must remove.
+func buildOnce(ctx context.Context, path string, opts []Option) ([]Artifact, string, error) {
+	spec, err := NewSpec(path, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer spec.Cleanup()
+	if err := spec.BuildSteps(ctx); err != nil {
+		return nil, "", err
+	}
+	dir, err := os.MkdirTemp(spec.workRoot, spec.Name+"-repro-*")
+	if err != nil {
+		return nil, "", fmt.Errorf("%w", err)
+	}
+	artifacts, err := spec.CreatePackages(dir)
+	return artifacts, dir, err
+}
+
+// CheckReproducible builds the spec at path twice, each in its own working directory, and
+// compares the resulting package archives by b3sum. An error wrapping errNotReproducible is
+// returned along with the results if any archive differs.
+func CheckReproducible(ctx context.Context, path string, opts ...Option) ([]ReproResult, error) {
+	var builds [2][]Artifact
+	for i := range builds {
+		artifacts, dir, err := buildOnce(ctx, path, opts)
+		defer os.RemoveAll(dir)
+		if err != nil {
+			return nil, err
+		}
+		builds[i] = artifacts
+	}
+	results := make([]ReproResult, 0, len(builds[0]))
+	var failed []string
+	for i, first := range builds[0] {
+		second := builds[1][i]
+		result := ReproResult{Name: first.Name, B3Sums: [2]string{first.B3Sum, second.B3Sum}}
+		if !result.Reproducible() {
+			differences, err := compareArchives(first.Path, second.Path)
+			if err != nil {
+				return nil, err
+			}
+			result.Differences = differences
+			failed = append(failed, first.Name)
+		}
+		results = append(results, result)
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("%w: %v", errNotReproducible, failed)
+	}
+	return results, nil
+}
@@ -0,0 +1,41 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReproducible(t *testing.T) {
+	t.Parallel()
+	t.Run("Should report identical archives as reproducible", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		results, err := CheckReproducible(context.Background(), "testdata/spec_with_packages.yaml",
+			WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf), WithWorkDir(t.TempDir()))
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.True(t, results[0].Reproducible())
+		assert.Empty(t, results[0].Differences)
+	})
+	t.Run("Should report which files differ", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		results, err := CheckReproducible(context.Background(), "testdata/spec_not_reproducible.yaml",
+			WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf), WithWorkDir(t.TempDir()))
+		require.EqualError(t, err, "build is not reproducible: [hello]")
+		require.Len(t, results, 1)
+		assert.False(t, results[0].Reproducible())
+		assert.Equal(t, []string{manifestName, "share/builddir"}, results[0].Differences)
+	})
+	t.Run("Should fail when the build fails", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		_, err := CheckReproducible(context.Background(), "testdata/spec_with_build_errors.yaml",
+			WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf), WithSourceCache(t.TempDir()))
+		require.EqualError(t, err, "exit status 1")
+	})
+}
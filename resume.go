@@ -0,0 +1,93 @@
+package mere
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const stateFile = "state.json"
+
+var errResume = errors.New("unable to resume working directory")
+
+// buildState records the details of a working directory needed to resume a build within it,
+// along with the spec it was created for.
+type buildState struct {
+	Name            string   `json:"name"`
+	Version         string   `json:"version"`
+	Release         int64    `json:"release"`
+	B3Sums          []string `json:"b3sums"`
+	BuildContext    string   `json:"buildContext"`
+	SourceDateEpoch int64    `json:"sourceDateEpoch"`
+}
+
+// newBuildState returns the state of the spec's build.
+func (s *Spec) newBuildState() buildState {
+	state := buildState{
+		Name:            s.Name,
+		Version:         s.Version,
+		Release:         s.Release,
+		B3Sums:          make([]string, 0, len(s.Sources)),
+		BuildContext:    s.buildContext,
+		SourceDateEpoch: s.sourceDateEpoch,
+	}
+	for _, source := range s.Sources {
+		state.B3Sums = append(state.B3Sums, source.B3Sum)
+	}
+	return state
+}
+
+// describe returns the name, version and release of the spec the state was created for, along
+// with its source b3sums.
+func (b buildState) describe() string {
+	return fmt.Sprintf("%s %s-%d (sources %s)", b.Name, b.Version, b.Release, strings.Join(b.B3Sums, ", "))
+}
+
+// saveState writes the build state into the working directory.
+func (s *Spec) saveState() error {
+	data, _ := json.Marshal(s.newBuildState())
+	if err := os.WriteFile(filepath.Join(s.workingDir, stateFile), data, logFilePerm); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// resume reuses an existing working directory and its build context, rather than fetching
+// and extracting sources into a new one. The directory must have been created for the same
+// name, version, release and sources as the spec.
+func (s *Spec) resume(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errResume, err)
+	}
+	var state buildState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%w: %w", errResume, err)
+	}
+	current := s.newBuildState()
+	if state.Name != current.Name || state.Version != current.Version || state.Release != current.Release ||
+		!slices.Equal(state.B3Sums, current.B3Sums) {
+		return fmt.Errorf("%w: %s was created for %s, not %s", errResume, dir, state.describe(), current.describe())
+	}
+	s.workingDir = dir
+	s.buildContext = state.BuildContext
+	s.sourceDateEpoch = state.SourceDateEpoch
+	if err := s.setupLogDir(); err != nil {
+		return err
+	}
+	s.log.Info("Resuming in context directory " + s.buildContext)
+	return nil
+}
+
+// WorkingDir returns the working directory of the build, which may be given to WithResume.
+func (s *Spec) WorkingDir() string {
+	return s.workingDir
+}
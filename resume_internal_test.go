@@ -0,0 +1,72 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResume(t *testing.T) {
+	t.Parallel()
+	t.Run("Should reuse a previous working directory and build context", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		first, err := NewSpec("testdata/spec_local_file.yaml", WithLogger(Log{Output: &buf}),
+			WithStageOutput(&buf, &buf), WithSourceCache(t.TempDir()), WithOnlyStages("build"))
+		require.NoError(t, err)
+		require.NoError(t, first.BuildSteps(context.Background()))
+		defer first.Cleanup()
+		marker := filepath.Join(first.buildContext, "marker")
+		require.NoError(t, os.WriteFile(marker, []byte("kept"), 0o600))
+
+		second, err := NewSpec("testdata/spec_local_file.yaml", WithLogger(Log{Output: &buf}),
+			WithStageOutput(&buf, &buf), WithResume(first.WorkingDir()), WithOnlyStages("install"))
+		require.NoError(t, err)
+		require.NoError(t, second.BuildSteps(context.Background()))
+		assert.Equal(t, first.buildContext, second.buildContext)
+		assert.Equal(t, first.sourceDateEpoch, second.sourceDateEpoch)
+		assert.FileExists(t, marker)
+		require.Len(t, second.Summary(), 1)
+		assert.Equal(t, "install", second.Summary()[0].Name)
+	})
+	t.Run("Should refuse a directory created for another version or sources", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		first, err := NewSpec("testdata/spec_local_file.yaml", WithLogger(Log{Output: &buf}),
+			WithStageOutput(&buf, &buf), WithSourceCache(t.TempDir()), WithOnlyStages("build"))
+		require.NoError(t, err)
+		require.NoError(t, first.BuildSteps(context.Background()))
+		defer first.Cleanup()
+
+		for _, change := range []func(*Spec){
+			func(s *Spec) { s.Name = "other" },
+			func(s *Spec) { s.Version = "9.9" },
+			func(s *Spec) { s.Release++ },
+			func(s *Spec) { s.Sources[0].B3Sum = strings.Repeat("0", 64) },
+		} {
+			second, err := NewSpec("testdata/spec_local_file.yaml", WithLogger(Log{Output: &buf}),
+				WithStageOutput(&buf, &buf), WithResume(first.WorkingDir()), WithOnlyStages("install"))
+			require.NoError(t, err)
+			change(second)
+			err = second.BuildSteps(context.Background())
+			require.ErrorIs(t, err, errResume)
+			assert.ErrorContains(t, err, "was created for "+first.Name)
+			assert.Empty(t, second.Summary())
+		}
+	})
+	t.Run("Should fail when the directory was not created by a build", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_no_sources.yaml", WithLogger(Log{Output: &buf}), WithResume(t.TempDir()))
+		require.NoError(t, err)
+		err = spec.BuildSteps(context.Background())
+		require.ErrorIs(t, err, errResume)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,44 @@
+package mere
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/alecthomas/jsonschema"
+)
+
+var errUnknownSchema = errors.New("unknown schema")
+
+// schemaTypes holds the values whose types describe each file format with a published schema.
+var schemaTypes = map[string]any{
+	"spec":     &Spec{},
+	"manifest": &Manifest{},
+	"index":    &Index{},
+}
+
+// SchemaNames returns the names of the file formats accepted by Schema.
+func SchemaNames() []string {
+	return sortedKeys(schemaTypes)
+}
+
+// reflectSchema returns the JSON Schema of the type of v, with its fields expanded at the top level.
+func reflectSchema(v any) *jsonschema.Schema {
+	reflector := new(jsonschema.Reflector)
+	reflector.ExpandedStruct = true
+	return reflector.Reflect(v)
+}
+
+// Schema returns the indented JSON Schema of the named file format: spec, manifest or index.
+// Editors use it to complete and validate spec files.
+func Schema(name string) ([]byte, error) {
+	v, ok := schemaTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownSchema, name)
+	}
+	data, err := json.MarshalIndent(reflectSchema(v), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,63 @@
+package mere
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// requireSchemaValid validates the JSON form of v against the named schema.
+func requireSchemaValid(t *testing.T, name string, v any) {
+	t.Helper()
+	schema, err := Schema(name)
+	require.NoError(t, err)
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewGoLoader(v))
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors())
+}
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+	t.Run("Should describe the fields of specs with their constraints", func(t *testing.T) {
+		t.Parallel()
+		data, err := Schema("spec")
+		require.NoError(t, err)
+		var schema struct {
+			Properties map[string]struct {
+				Description string  `json:"description"`
+				Pattern     string  `json:"pattern"`
+				Minimum     float64 `json:"minimum"`
+				Examples    []any   `json:"examples"`
+			} `json:"properties"`
+		}
+		require.NoError(t, json.Unmarshal(data, &schema))
+		assert.NotEmpty(t, schema.Properties["name"].Description)
+		assert.NotEmpty(t, schema.Properties["name"].Pattern)
+		assert.NotEmpty(t, schema.Properties["version"].Examples)
+		assert.InDelta(t, 1, schema.Properties["release"].Minimum, 0)
+	})
+	t.Run("Should validate the manifests and index of a repo", func(t *testing.T) {
+		t.Parallel()
+		_, artifacts, _ := buildPackages(t, "testdata/spec_with_packages.yaml")
+		repo := Repo{Path: t.TempDir()}
+		require.NoError(t, repo.Add(artifacts))
+		for _, artifact := range artifacts {
+			requireSchemaValid(t, "manifest", artifact.Manifest)
+		}
+		data, err := os.ReadFile(filepath.Join(repo.Path, indexFile))
+		require.NoError(t, err)
+		var index any
+		require.NoError(t, json.Unmarshal(data, &index))
+		requireSchemaValid(t, "index", index)
+	})
+	t.Run("Should fail for an unknown schema", func(t *testing.T) {
+		t.Parallel()
+		_, err := Schema("config")
+		require.ErrorIs(t, err, errUnknownSchema)
+	})
+}
@@ -0,0 +1,75 @@
+package mere
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// debugShell is started to inspect a build after a stage fails.
+type debugShell struct {
+	script string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// interactiveShell returns an interactive sh attached to the standard streams of the process.
+func interactiveShell() *debugShell {
+	return &debugShell{
+		script: "export PS1='mere> '\nexec sh -i",
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+}
+
+// shellOnFailure starts the debug shell, if configured, in the directory and environment of
+// the failed stage. The working directory is left untouched until the shell exits.
+func (s *Spec) shellOnFailure(ctx context.Context, stage Stage) {
+	if s.debugShell == nil {
+		return
+	}
+	dir := s.stageDir(stage)
+	s.log.Info(fmt.Sprintf("Stage %s failed, starting a shell in %s. Exit the shell to continue.", stage.Name, dir))
+	if err := s.runShell(ctx, stage); err != nil {
+		s.log.Warn("Shell exited with an error: " + err.Error())
+	}
+}
+
+// runShell runs the debug shell as the failed stage ran: as root in a user namespace with
+// WithFakeroot, and in a cgroup enforcing the same limits. It is not killed by the timeouts of
+// the build. When its input is the terminal, the shell becomes its foreground process group,
+// so that Ctrl-C interrupts the commands run in the shell rather than the build.
+func (s *Spec) runShell(ctx context.Context, stage Stage) error {
+	stage.Cmd = s.debugShell.script
+	cg, err := s.stageCgroup(stage)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errEnforceLimits, err)
+	}
+	if cg != nil {
+		defer func() {
+			if err := cg.remove(); err != nil {
+				s.log.Warn("Unable to remove cgroup: " + err.Error())
+			}
+		}()
+	}
+	discard := stageLog{stdout: io.Discard, stderr: io.Discard}
+	cmd, finish, err := s.stageCommand(context.WithoutCancel(ctx), stage, discard)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = s.debugShell.stdin
+	cmd.Stdout = s.debugShell.stdout
+	cmd.Stderr = s.debugShell.stderr
+	restore := useTerminal(cmd)
+	defer restore()
+	if err := startStage(cmd, finish, cg); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
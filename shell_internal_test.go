@@ -0,0 +1,62 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_shellOnFailure(t *testing.T) {
+	t.Parallel()
+	t.Run("Should start a shell in the stage environment when a stage fails", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_build_errors.yaml", WithLogger(Log{Output: &buf}),
+			WithStageOutput(&buf, &buf), WithSourceCache(t.TempDir()), WithShellOnFailure())
+		require.NoError(t, err)
+		assert.Equal(t, interactiveShell(), spec.debugShell)
+		var out bytes.Buffer
+		spec.debugShell = &debugShell{script: "pwd\nenv\nexit 3", stdout: &out, stderr: &out}
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		require.EqualError(t, err, "exit status 1")
+		assert.Contains(t, out.String(), spec.buildContext+"\n")
+		assert.Contains(t, out.String(), "MERE_PKGDIR="+spec.workingDir+"/package\n")
+		assert.Contains(t, buf.String(), "Stage build failed, starting a shell in "+spec.buildContext)
+		assert.Contains(t, buf.String(), "warning: Shell exited with an error: exit status 3")
+	})
+	t.Run("Should start the shell in the user namespace of a fakeroot build", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_build_errors.yaml", WithLogger(Log{Output: &buf}),
+			WithStageOutput(&buf, &buf), WithSourceCache(t.TempDir()), WithShellOnFailure(), WithFakeroot())
+		require.NoError(t, err)
+		spec.uidMap = []idMap{{container: 0, host: os.Getuid(), size: 1}}
+		var out bytes.Buffer
+		spec.debugShell = &debugShell{script: "cat /proc/self/uid_map", stdout: &out, stderr: &out}
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		if err != nil && strings.Contains(err.Error(), "operation not permitted") {
+			t.Skip("user namespaces are not permitted: " + err.Error())
+		}
+		assert.Equal(t, []string{"0", fmt.Sprint(os.Getuid()), "1"}, strings.Fields(out.String()))
+	})
+	t.Run("Should not start a shell when the build succeeds", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_no_sources.yaml", WithLogger(Log{Output: &buf}),
+			WithStageOutput(&buf, &buf), WithShellOnFailure())
+		require.NoError(t, err)
+		var out bytes.Buffer
+		spec.debugShell = &debugShell{script: "echo started", stdout: &out, stderr: &out}
+		require.NoError(t, spec.BuildSteps(context.Background()))
+		defer spec.Cleanup()
+		assert.Empty(t, out.String())
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !unix || aix || solaris
+
+package mere
+
+import "os/exec"
+
+// useTerminal does nothing, the terminal is only handed to commands on Linux, macOS and the BSDs.
+func useTerminal(*exec.Cmd) func() {
+	return func() {}
+}
@@ -0,0 +1,35 @@
+//go:build unix && !aix && !solaris
+
+package mere
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// useTerminal makes cmd the foreground process group of the terminal it reads from, when mere
+// is in the foreground of that terminal, such that the signals typed at the terminal only reach
+// cmd. The returned function brings mere back to the foreground once cmd has exited.
+func useTerminal(cmd *exec.Cmd) func() {
+	tty, ok := cmd.Stdin.(*os.File)
+	if !ok {
+		return func() {}
+	}
+	fd := int(tty.Fd())
+	if pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP); err != nil || pgrp != syscall.Getpgrp() {
+		return func() {}
+	}
+	// The terminal is the standard input of cmd.
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = 0
+	return func() {
+		// A background process group may only take the terminal while it ignores SIGTTOU.
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		_ = unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, syscall.Getpgrp())
+	}
+}
@@ -0,0 +1,267 @@
+package mere
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Build systems detected by NewSkeleton.
+const (
+	BuildSystemAutotools = "autotools"
+	BuildSystemCMake     = "cmake"
+	BuildSystemMeson     = "meson"
+	BuildSystemCargo     = "cargo"
+	BuildSystemGo        = "go"
+	BuildSystemMake      = "make"
+)
+
+var (
+	errGuess = errors.New("unable to guess the name and version")
+
+	archiveExtensions = []string{
+		".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tbz", ".tar.xz", ".txz", ".tar.zst", ".tzst", ".tar",
+	}
+	nameVersionRegex = regexp.MustCompile(`^(.+?)[-_]v?(\d[\w.+~]*)$`)
+	versionOnlyRegex = regexp.MustCompile(`^v?(\d[\w.+~]*)$`)
+)
+
+// buildSystem holds the marker file of a build system and the commands building with it.
+type buildSystem struct {
+	name    string
+	marker  string
+	build   string
+	install string
+}
+
+// buildSystems are tried in order, such that a configure script is preferred to the Makefile
+// it generates.
+var buildSystems = []buildSystem{
+	{
+		name:    BuildSystemAutotools,
+		marker:  "configure",
+		build:   "./configure --prefix=/usr\nmake -j\"$MERE_JOBS\"\n",
+		install: "make DESTDIR=\"$MERE_PKGDIR\" install\n",
+	},
+	{
+		name:   BuildSystemCMake,
+		marker: "CMakeLists.txt",
+		build: "cmake -B build -DCMAKE_INSTALL_PREFIX=/usr -DCMAKE_BUILD_TYPE=Release\n" +
+			"cmake --build build -j \"$MERE_JOBS\"\n",
+		install: "DESTDIR=\"$MERE_PKGDIR\" cmake --install build\n",
+	},
+	{
+		name:    BuildSystemMeson,
+		marker:  "meson.build",
+		build:   "meson setup build --prefix=/usr --buildtype=release\nmeson compile -C build -j \"$MERE_JOBS\"\n",
+		install: "meson install -C build --destdir \"$MERE_PKGDIR\"\n",
+	},
+	{
+		name:    BuildSystemCargo,
+		marker:  "Cargo.toml",
+		build:   "cargo build --release --locked -j \"$MERE_JOBS\"\n",
+		install: "cargo install --path . --root \"$MERE_PKGDIR/usr\" --locked --no-track\n",
+	},
+	{
+		name:    BuildSystemGo,
+		marker:  "go.mod",
+		build:   "go build -trimpath -o {{.Name}} .\n",
+		install: "install -Dm755 {{.Name}} \"$MERE_PKGDIR/usr/bin/{{.Name}}\"\n",
+	},
+	{
+		name:    BuildSystemMake,
+		marker:  "Makefile",
+		build:   "make -j\"$MERE_JOBS\" PREFIX=/usr\n",
+		install: "make DESTDIR=\"$MERE_PKGDIR\" PREFIX=/usr install\n",
+	},
+}
+
+// Skeleton holds what NewSkeleton learned about a source archive, from which a spec is written.
+type Skeleton struct {
+	Name    string
+	Version string
+	Home    string
+	// URL is the source URL, templated on the version.
+	URL   string
+	B3Sum string
+	// BuildSystem is the detected build system, empty if none was found.
+	BuildSystem string
+}
+
+// trimArchiveExt removes a known archive extension from name.
+func trimArchiveExt(name string) string {
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// guessNameVersion splits a name such as hello-1.2.3 into its name and version.
+func guessNameVersion(base string) (string, string, bool) {
+	if m := nameVersionRegex.FindStringSubmatch(base); m != nil {
+		return m[1], m[2], true
+	}
+	return "", "", false
+}
+
+// archiveLayout returns the entries of the top level of the source tree within the archive,
+// below its only top level directory if it has one, along with that directory.
+func archiveLayout(archive string) (map[string]bool, string, error) {
+	var names []string
+	err := walkTar(archive, func(header *tar.Header, _ io.Reader) error {
+		if name := path.Clean(strings.TrimPrefix(header.Name, "./")); name != "." {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	top := ""
+	for _, name := range names {
+		first, _, _ := strings.Cut(name, "/")
+		if top == "" {
+			top = first
+		} else if first != top {
+			top = ""
+			break
+		}
+	}
+	entries := make(map[string]bool)
+	for _, name := range names {
+		if top != "" {
+			if name == top {
+				continue
+			}
+			name = strings.TrimPrefix(name, top+"/")
+		}
+		first, _, _ := strings.Cut(name, "/")
+		entries[first] = true
+	}
+	if len(entries) == 0 {
+		top = ""
+	}
+	return entries, top, nil
+}
+
+// NewSkeleton downloads the source archive at rawURL into the source cache, computes its b3sum
+// and inspects it for the marker file of a known build system. The name and version are
+// guessed from the file name, such as hello-1.2.3.tar.gz, or else from the top level directory
+// of the archive. The options of NewSpec which concern fetching sources apply.
+func NewSkeleton(ctx context.Context, rawURL string, opts ...Option) (Skeleton, error) {
+	var skeleton Skeleton
+	o := newOptions(opts)
+	source := Source{URL: rawURL}
+	if err := source.validateSource(); err != nil {
+		return skeleton, err
+	}
+	spec := &Spec{sourceCache: o.resolveSourceCache(), httpclient: o.httpclient, log: o.log}
+	if source.protocol == httpProto && spec.httpclient == nil {
+		spec.httpclient = newHTTPClient()
+	}
+	b3sum, err := source.rehash(ctx, spec)
+	if err != nil {
+		return skeleton, err
+	}
+	skeleton.B3Sum = b3sum
+	entries, top, err := archiveLayout(filepath.Join(spec.sourceCache, source.cacheName()))
+	if err != nil {
+		return skeleton, err
+	}
+
+	base := trimArchiveExt(source.cacheName())
+	name, version, ok := guessNameVersion(base)
+	if !ok {
+		name, version, ok = guessNameVersion(top)
+		if m := versionOnlyRegex.FindStringSubmatch(base); !ok && m != nil && top != "" {
+			// Archives of tags are often named after the version alone.
+			name, version, ok = top, m[1], true
+		}
+	}
+	if !ok {
+		return skeleton, fmt.Errorf("%w from %s", errGuess, rawURL)
+	}
+	skeleton.Name = strings.ToLower(name)
+	skeleton.Version = version
+	// Only the path is templated, a version may well look like part of a host name.
+	skeleton.URL = strings.ReplaceAll(rawURL, version, "{{.Version}}")
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		skeleton.Home = parsed.Scheme + "://" + parsed.Host
+		skeleton.URL = skeleton.Home + strings.ReplaceAll(strings.TrimPrefix(rawURL, skeleton.Home), version,
+			"{{.Version}}")
+	}
+	for _, system := range buildSystems {
+		if entries[system.marker] {
+			skeleton.BuildSystem = system.name
+			break
+		}
+	}
+	o.log.Info(fmt.Sprintf("Detected %s %s, build system: %s", skeleton.Name, skeleton.Version,
+		valueOr(skeleton.BuildSystem, "none")))
+	return skeleton, nil
+}
+
+// valueOr returns v, or fallback when v is empty.
+func valueOr(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
+
+// yamlScalar formats v as a YAML scalar, quoting it when needed.
+func yamlScalar(v string) string {
+	data, _ := yamlv3.Marshal(v)
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// yamlBlock formats a multi-line value as a literal block indented below its key.
+func yamlBlock(key, v string) string {
+	var b strings.Builder
+	b.WriteString(key + ": |\n")
+	for _, line := range strings.SplitAfter(v, "\n") {
+		if line != "" {
+			b.WriteString("  " + line)
+		}
+	}
+	return b.String()
+}
+
+// YAML returns the spec described by the skeleton.
+func (s Skeleton) YAML() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "name: %s\n", yamlScalar(s.Name))
+	fmt.Fprintf(&b, "description: %s\n", yamlScalar(""))
+	fmt.Fprintf(&b, "version: %s\n", yamlScalar(s.Version))
+	b.WriteString("release: 1\n")
+	fmt.Fprintf(&b, "home: %s\n", yamlScalar(s.Home))
+	b.WriteString("sources:\n")
+	fmt.Fprintf(&b, "  - url: %s\n", yamlScalar(s.URL))
+	fmt.Fprintf(&b, "    b3sum: %s\n", yamlScalar(s.B3Sum))
+	found := false
+	for _, system := range buildSystems {
+		if system.name == s.BuildSystem {
+			b.WriteString(yamlBlock("build", system.build))
+			b.WriteString(yamlBlock("install", system.install))
+			found = true
+		}
+	}
+	if !found {
+		b.WriteString("# No build system was detected, add build and install commands.\n")
+	}
+	b.WriteString("packages:\n")
+	fmt.Fprintf(&b, "  - name: %s\n", yamlScalar(s.Name))
+	return b.Bytes()
+}
@@ -0,0 +1,133 @@
+package mere
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTarGz writes a gzipped tar archive of empty files with the given names to path.
+func writeTarGz(t *testing.T, path string, names ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Typeflag: tar.TypeReg}))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+func TestNewSkeleton(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		file        string
+		entries     []string
+		skelName    string
+		version     string
+		buildSystem string
+	}{
+		{
+			name:        "autotools is preferred to make",
+			file:        "hello-1.2.3.tar.gz",
+			entries:     []string{"hello-1.2.3/configure", "hello-1.2.3/Makefile", "hello-1.2.3/src/main.c"},
+			skelName:    "hello",
+			version:     "1.2.3",
+			buildSystem: BuildSystemAutotools,
+		},
+		{
+			name:        "cmake",
+			file:        "Widget_v2.0.tgz",
+			entries:     []string{"widget/CMakeLists.txt"},
+			skelName:    "widget",
+			version:     "2.0",
+			buildSystem: BuildSystemCMake,
+		},
+		{
+			name:        "markers in subdirectories are ignored",
+			file:        "tool-0.9.tar.gz",
+			entries:     []string{"tool-0.9/README", "tool-0.9/sub/go.mod"},
+			skelName:    "tool",
+			version:     "0.9",
+			buildSystem: "",
+		},
+		{
+			name:        "archive without a top level directory",
+			file:        "lib-1.0.tar.gz",
+			entries:     []string{"meson.build", "lib.c"},
+			skelName:    "lib",
+			version:     "1.0",
+			buildSystem: BuildSystemMeson,
+		},
+		{
+			name:        "version from a tag archive",
+			file:        "v3.1.tar.gz",
+			entries:     []string{"crate-3.1/Cargo.toml"},
+			skelName:    "crate",
+			version:     "3.1",
+			buildSystem: BuildSystemCargo,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			archive := filepath.Join(dir, tt.file)
+			writeTarGz(t, archive, tt.entries...)
+			var buf bytes.Buffer
+			skeleton, err := NewSkeleton(context.Background(), archive,
+				WithLogger(Log{Output: &buf}), WithSourceCache(filepath.Join(dir, "cache")))
+			require.NoError(t, err)
+			sum, err := computeB3SumFromFile(archive)
+			require.NoError(t, err)
+			assert.Equal(t, tt.skelName, skeleton.Name)
+			assert.Equal(t, tt.version, skeleton.Version)
+			assert.Equal(t, tt.buildSystem, skeleton.BuildSystem)
+			assert.Equal(t, sum, skeleton.B3Sum)
+
+			// The generated spec must be valid and render the original URL.
+			path := filepath.Join(dir, "spec.yaml")
+			require.NoError(t, os.WriteFile(path, skeleton.YAML(), 0o600))
+			spec, err := NewSpec(path, WithLogger(Log{Output: &buf}))
+			require.NoError(t, err)
+			assert.Equal(t, archive, spec.Sources[0].URL)
+			assert.Equal(t, sum, spec.Sources[0].B3Sum)
+			assert.Equal(t, tt.skelName, spec.Packages[0].Name)
+		})
+	}
+	t.Run("Should template the version of a remote URL and not its host", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		skeleton, err := NewSkeleton(context.Background(), "https://example1.10.com/releases/hello-1.10.tar.gz",
+			WithLogger(Log{Output: &buf}), WithHTTPClient(&fixtureHTTP{}), WithSourceCache(t.TempDir()))
+		require.NoError(t, err)
+		assert.Equal(t, Skeleton{
+			Name:        "hello",
+			Version:     "1.10",
+			Home:        "https://example1.10.com",
+			URL:         "https://example1.10.com/releases/hello-{{.Version}}.tar.gz",
+			B3Sum:       skeleton.B3Sum,
+			BuildSystem: BuildSystemAutotools,
+		}, skeleton)
+	})
+	t.Run("Should fail when no version is found", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		archive := filepath.Join(dir, "hello.tar.gz")
+		writeTarGz(t, archive, "hello/configure")
+		var buf bytes.Buffer
+		_, err := NewSkeleton(context.Background(), archive,
+			WithLogger(Log{Output: &buf}), WithSourceCache(filepath.Join(dir, "cache")))
+		require.ErrorIs(t, err, errGuess)
+	})
+}
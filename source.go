@@ -1,9 +1,9 @@
 package mere
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net/url"
 	"os"
 	"path"
@@ -19,12 +19,11 @@ var (
 
 // Source defines the properties needed to retrieve and validate a source file.
 type Source struct {
-	URL       string `json:"url"`
-	B3Sum     string `json:"b3sum"               jsonschema:"minLength=64,maxLength=64"`
-	LocalName string `json:"localName,omitempty"`
+	URL       string `json:"url" jsonschema:"example=https://musl.libc.org/releases/musl-{{.Version}}.tar.gz" jsonschema_description:"URL or local path of the file, which may use templates"`
+	B3Sum     string `json:"b3sum" jsonschema:"minLength=64,maxLength=64,pattern=^[0-9a-f]{64}$" jsonschema_description:"BLAKE3 sum of the file in hex"`
+	LocalName string `json:"localName,omitempty" jsonschema_description:"Name to store the file under, by default the last element of the URL"`
 	protocol  string
 	savePath  string
-	output    io.Writer
 }
 
 func (source *Source) validateSource() error {
@@ -56,42 +55,54 @@ func (source *Source) validateSource() error {
 	return nil
 }
 
-func (source *Source) fetchSource(spec *Spec) error {
+// cacheName is the name of the file used to store the source in the source cache.
+func (source *Source) cacheName() string {
+	return path.Base(source.LocalName)
+}
+
+func (source *Source) fetchSource(ctx context.Context, spec *Spec) error {
 	if err := ensureDir(os.MkdirAll, spec.sourceCache); err != nil {
 		return err
 	}
 
-	source.savePath = strings.Join([]string{spec.sourceCache, path.Base(source.LocalName)}, "/")
+	source.savePath = strings.Join([]string{spec.sourceCache, source.cacheName()}, "/")
 
 	finfo, _ := os.Stat(source.savePath)
 	if finfo != nil {
-		return source.checkB3SumFromFile(source.savePath, source.B3Sum)
+		spec.log.Debug("Using cached " + source.savePath)
+		return checkB3SumFromFile(spec.log, source.savePath, source.B3Sum)
 	}
 
-	switch source.protocol {
-	case fileProto:
-		if err := fetchFile(copywrapper{}, source.LocalName, source.savePath); err != nil {
+	// Only complete downloads matching their b3sum are kept in the source cache.
+	return fetchAtomic(source.savePath, func(tmp string) error {
+		if err := source.download(ctx, spec, tmp); err != nil {
 			return err
 		}
+		spec.log.Info("Validating " + source.savePath)
+		return checkB3Sum(tmp, source.B3Sum)
+	})
+}
+
+// download retrieves the source to dest, without validating it.
+func (source *Source) download(ctx context.Context, spec *Spec, dest string) error {
+	spec.log.Info("Fetching " + source.URL)
+	switch source.protocol {
+	case fileProto:
+		return fetchFile(copywrapper{}, source.LocalName, dest)
 	case httpProto:
-		if err := fetchHTTP(spec.httpclient, source.URL, source.savePath); err != nil {
-			return err
-		}
+		return fetchHTTP(ctx, spec.httpclient, source.URL, dest)
 	default:
 		return fmt.Errorf("%w: %s", errProto, source.protocol)
 	}
-
-	if err := source.checkB3SumFromFile(source.savePath, source.B3Sum); err != nil {
-		return err
-	}
-
-	return nil
 }
 
-func (s *Spec) fetchSources() []error {
+func (s *Spec) fetchSources(ctx context.Context) []error {
 	errors := make([]error, 0, len(s.Sources))
 	for i := range s.Sources {
-		if err := s.Sources[i].fetchSource(s); err != nil {
+		if err := ctx.Err(); err != nil {
+			return append(errors, err)
+		}
+		if err := s.Sources[i].fetchSource(ctx, s); err != nil {
 			errors = append(errors, err)
 		}
 	}
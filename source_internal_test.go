@@ -2,6 +2,7 @@ package mere
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -26,17 +27,17 @@ type sourceTest struct {
 	sourceCache  string
 	localName    string
 	errMsg       string
-	client       doer
+	client       HTTPClient
 }
 
 func setupsource(t *testing.T, test sourceTest, filePath string) (func(t *testing.T), *Spec) {
 	t.Helper()
 	var buf bytes.Buffer
-	spec, _ := NewSpec("testdata/spec.yaml", &buf)
 	if test.sourceCache == "" {
 		test.sourceCache = sourceCache
 	}
-	spec.sourceCache = test.sourceCache
+	spec, _ := NewSpec("testdata/spec.yaml",
+		WithLogger(Log{Output: &buf}), WithSourceCache(test.sourceCache), WithHTTPClient(test.client))
 
 	if test.preExistFile {
 		if err := os.MkdirAll(spec.sourceCache, 0o755); err != nil {
@@ -133,7 +134,6 @@ func Test_fetchSource(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			t.Parallel()
 			assert := assert.New(t)
-			var buf bytes.Buffer
 			if tc.sourceCache == "" {
 				tc.sourceCache = fmt.Sprintf("%s%d", sourceCache, i)
 			}
@@ -145,18 +145,21 @@ func Test_fetchSource(t *testing.T) {
 				B3Sum:     tc.b3sum,
 				LocalName: tc.localName,
 				savePath:  filePath,
-				output:    &buf,
 			}
 			err := source.validateSource()
 			require.NoError(t, err)
-			spec.httpclient = tc.client
-			err = source.fetchSource(spec)
+			err = source.fetchSource(context.Background(), spec)
 			if tc.errMsg != "" {
 				if err == nil {
 					t.Errorf("expected an error but didn't receive one")
 				} else {
 					assert.Contains(err.Error(), tc.errMsg)
 				}
+				if !tc.preExistFile {
+					// Failed downloads leave nothing behind in the source cache.
+					entries, _ := os.ReadDir(tc.sourceCache)
+					assert.Empty(entries)
+				}
 			} else {
 				require.NoError(t, err)
 				finfo, err := os.Stat(filePath)
@@ -219,8 +222,7 @@ func Test_fetchSources(t *testing.T) {
 		t.Parallel()
 		var buf bytes.Buffer
 		assert := assert.New(t)
-		spec, _ := NewSpec("testdata/spec.yaml", &buf)
-		spec.sourceCache = sourceCache
+		spec, _ := NewSpec("testdata/spec.yaml", WithLogger(Log{Output: &buf}), WithSourceCache(sourceCache))
 		defer os.RemoveAll(sourceCache)
 		spec.Sources = []Source{
 			{
@@ -233,7 +235,7 @@ func Test_fetchSources(t *testing.T) {
 				LocalName: "blergh",
 			},
 		}
-		errors := spec.fetchSources()
+		errors := spec.fetchSources(context.Background())
 		assert.Len(errors, len(spec.Sources))
 	})
 }
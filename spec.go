@@ -5,24 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"os/user"
 	"strings"
-	"text/template"
 	"time"
 
-	"github.com/alecthomas/jsonschema"
-	"github.com/fcjr/aia-transport-go"
 	"github.com/ghodss/yaml"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/xeipuuv/gojsonschema"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 const (
 	configDir = "/.mere"
 	srcDir    = "/src"
-	timeout   = 30
+	buildsDir = "/builds"
 )
 
 var (
@@ -32,36 +28,79 @@ var (
 
 // Package defines the properties needed to create an individual package.
 type Package struct {
-	Name  string   `json:"name"`
-	Deps  []string `json:"deps,omitempty"`
-	Files []string `json:"files,omitempty"`
-	Libs  []string `json:"libs,omitempty"`
+	Name  string   `json:"name" jsonschema:"pattern=^[a-z0-9][a-z0-9+._-]*$,example=musl-dev" jsonschema_description:"Name of the package"`
+	Deps  []string `json:"deps,omitempty" jsonschema_description:"Packages needed at runtime"`
+	Files []string `json:"files,omitempty" jsonschema_description:"Globs of the files in the package, relative to the package directory. The first package without files receives every file not claimed by another package"`
+	Libs  []string `json:"libs,omitempty" jsonschema_description:"Shared libraries provided by the package"`
 }
 
 // Spec contains the properties needed to build one or more packages
 // from the same source code.
 type Spec struct {
-	Name         string    `json:"name"`
-	Description  string    `json:"description"`
-	Home         string    `json:"home"`
-	Version      string    `json:"version"`
-	Release      int64     `json:"release"`
-	Sources      []Source  `json:"sources,omitempty"`
-	BuildDeps    string    `json:"buildDeps,omitempty"`
-	Build        string    `json:"build,omitempty"`
-	Test         string    `json:"test,omitempty"`
-	Install      string    `json:"install,omitempty"`
-	Packages     []Package `json:"packages"`
-	httpclient   doer
-	sourceCache  string
-	buildContext string
-	workingDir   string
-	buildOrder   []map[string]string
-	output       io.Writer
+	Name        string            `json:"name" jsonschema:"pattern=^[a-z0-9][a-z0-9+._-]*$,example=musl" jsonschema_description:"Name of the software, used for its packages and in templates as {{.Name}}"`
+	Description string            `json:"description" jsonschema_description:"Short description of the software"`
+	Home        string            `json:"home" jsonschema:"example=https://musl.libc.org" jsonschema_description:"Home page of the software"`
+	Version     string            `json:"version" jsonschema:"pattern=^[0-9A-Za-z][0-9A-Za-z.+~_]*$,example=1.2.5" jsonschema_description:"Upstream version, used in templates as {{.Version}}. A tilde marks a pre-release"`
+	Release     int64             `json:"release" jsonschema:"minimum=1,example=1" jsonschema_description:"Release of the packages of this version, reset to 1 when the version changes"`
+	Sources     []Source          `json:"sources,omitempty" jsonschema_description:"Files to fetch and verify before building, archives are extracted"`
+	BuildDeps   string            `json:"buildDeps,omitempty" jsonschema:"example=make musl-dev" jsonschema_description:"Space separated packages needed to build"`
+	Build       string            `json:"build,omitempty" jsonschema_description:"Shell commands of the build stage"`
+	Test        string            `json:"test,omitempty" jsonschema_description:"Shell commands of the test stage"`
+	Install     string            `json:"install,omitempty" jsonschema_description:"Shell commands of the install stage, which install files into $MERE_PKGDIR"`
+	Stages      []Stage           `json:"stages,omitempty" jsonschema_description:"Custom stages, executed in order instead of build, test and install"`
+	Env         map[string]string `json:"env,omitempty" jsonschema_description:"Environment variables of every stage"`
+	Arches      []string          `json:"arch,omitempty" jsonschema:"example=x86_64" jsonschema_description:"Architectures the spec can be built for, as named by uname -m. Any when empty"`
+	// Overrides replace fields of the spec when it is built for an architecture, by architecture.
+	Overrides map[string]Override `json:"overrides,omitempty" jsonschema_description:"Fields replaced when building for an architecture, by architecture"`
+	Vars      map[string]string   `json:"vars,omitempty" jsonschema_description:"Variables available to templates as {{.Vars.name}}, rendered before any other field"`
+	// Upstream describes where to look for new versions, see CheckUpdates.
+	Upstream *Upstream `json:"upstream,omitempty" jsonschema_description:"Where to look for new versions"`
+	// Limits restricts the resources of each stage, the configuration file may set stricter limits.
+	Limits Limits `json:"limits,omitempty" jsonschema_description:"Resource limits of each stage"`
+	// Timeout is the maximum duration of the whole build, such as 2h.
+	Timeout string `json:"timeout,omitempty" jsonschema:"example=2h" jsonschema_description:"Maximum duration of the whole build"`
+	// SourceDateEpoch overrides the SOURCE_DATE_EPOCH derived from the first source archive.
+	SourceDateEpoch int64     `json:"sourceDateEpoch,omitempty" jsonschema:"minimum=0" jsonschema_description:"Overrides the SOURCE_DATE_EPOCH derived from the first source archive"`
+	Packages        []Package `json:"packages" jsonschema:"minItems=1" jsonschema_description:"Packages created from the build"`
+	httpclient      HTTPClient
+	sourceCache     string
+	buildContext    string
+	workRoot        string
+	workingDir      string
+	logDir          string
+	persistLogDir   string
+	results         []StageResult
+	env             map[string]string
+	profile         BuildProfile
+	sourceDateEpoch int64
+	nodes           *specLocator
+	arch            string
+	overridden      map[string]string
+	buildOrder      []Stage
+	onlyStages      []string
+	skipStages      []string
+	resumeDir       string
+	debugShell      *debugShell
+	timeout         time.Duration
+	limits          resourceLimits
+	cgroupParent    string
+	fakeroot        bool
+	depVersions     map[string]string
+	repo            string
+	githubAPI       string
+	path            string
+	opts            []Option
+	buildUID        int
+	buildGID        int
+	uidMap          []idMap
+	gidMap          []idMap
+	log             Logger
+	stdout          io.Writer
+	stderr          io.Writer
 }
 
 func (s *Spec) render(v string) (string, error) {
-	tl, err := template.New("").Parse(v)
+	tl, err := newTemplate(v)
 	if err != nil {
 		return "", fmt.Errorf("%w", err)
 	}
@@ -74,43 +113,93 @@ func (s *Spec) render(v string) (string, error) {
 	return buf.String(), nil
 }
 
-func (s *Spec) renderAll() error {
-	var err error
-	var errmsgs []string
+// templatedField is a field of the spec which may hold a template, along with its path
+// in the spec file, such as sources.0.url.
+type templatedField struct {
+	path  string
+	value string
+	set   func(string)
+}
 
-	// render values for possible template strings of specific fields.
-	// Currently supported: sources[].url, packages[].files[], build, test and install.
-	for i := range s.Sources {
-		if s.Sources[i].URL, err = s.render(s.Sources[i].URL); err != nil {
-			errmsgs = append(errmsgs, err.Error())
+// templatedFields returns the fields whose values are rendered as templates, in the order
+// they are rendered. Currently supported: vars values, description, home, sources[].url,
+// upstream.url, packages[].deps[] and packages[].files[], build, test, install, env values and
+// the cmd, workdir and env values of stages. Vars are rendered first, in the order of varOrder,
+// such that other fields and vars may refer to their rendered values.
+func (s *Spec) templatedFields() []templatedField {
+	var fields []templatedField
+	add := func(value *string, format string, args ...any) {
+		fields = append(fields, templatedField{
+			path:  s.fieldPath(fmt.Sprintf(format, args...)),
+			value: *value,
+			set:   func(v string) { *value = v },
+		})
+	}
+	addKeys := func(env map[string]string, keys []string, prefix string) {
+		for _, key := range keys {
+			fields = append(fields, templatedField{
+				path:  s.fieldPath(prefix + key),
+				value: env[key],
+				set:   func(v string) { env[key] = v },
+			})
 		}
 	}
-
+	addEnv := func(env map[string]string, prefix string) {
+		addKeys(env, sortedKeys(env), prefix)
+	}
+	vars, _ := varOrder(s.Vars)
+	addKeys(s.Vars, vars, "vars.")
+	add(&s.Description, "description")
+	add(&s.Home, "home")
+	for i := range s.Sources {
+		add(&s.Sources[i].URL, "sources.%d.url", i)
+	}
+	if s.Upstream != nil {
+		add(&s.Upstream.URL, "upstream.url")
+	}
 	for i := range s.Packages {
+		for ii := range s.Packages[i].Deps {
+			add(&s.Packages[i].Deps[ii], "packages.%d.deps.%d", i, ii)
+		}
 		for ii := range s.Packages[i].Files {
-			if s.Packages[i].Files[ii], err = s.render(s.Packages[i].Files[ii]); err != nil {
-				errmsgs = append(errmsgs, err.Error())
-			}
+			add(&s.Packages[i].Files[ii], "packages.%d.files.%d", i, ii)
 		}
 	}
-
-	if s.Build, err = s.render(s.Build); err != nil {
-		errmsgs = append(errmsgs, err.Error())
+	add(&s.Build, "build")
+	add(&s.Test, "test")
+	add(&s.Install, "install")
+	addEnv(s.Env, "env.")
+	for i := range s.Stages {
+		add(&s.Stages[i].Cmd, "stages.%d.cmd", i)
+		add(&s.Stages[i].Workdir, "stages.%d.workdir", i)
+		addEnv(s.Stages[i].Env, fmt.Sprintf("stages.%d.env.", i))
 	}
+	return fields
+}
 
-	if s.Test, err = s.render(s.Test); err != nil {
-		errmsgs = append(errmsgs, err.Error())
+// locator returns the locator of the spec file, or one placing every error at its start for
+// specs which were not read from a file.
+func (s *Spec) locator() *specLocator {
+	if s.nodes == nil {
+		return &specLocator{path: s.path, root: &yamlv3.Node{Line: 1, Column: 1}}
 	}
+	return s.nodes
+}
 
-	if s.Install, err = s.render(s.Install); err != nil {
-		errmsgs = append(errmsgs, err.Error())
+// renderAll renders every templated field, adding all errors to errs at their position in the
+// spec file.
+func (s *Spec) renderAll(errs *SpecErrors) {
+	if _, cycle := varOrder(s.Vars); cycle != nil {
+		errs.add(errRender, s.locator().fieldError(s.fieldPath("vars."+cycle[0]),
+			"vars refer to each other in a cycle: %s", strings.Join(cycle, " -> ")))
 	}
-
-	if len(errmsgs) > 0 {
-		return fmt.Errorf("%w: %s", errRender, strings.Join(errmsgs, "; "))
+	for _, field := range s.templatedFields() {
+		v, err := s.render(field.value)
+		if err != nil {
+			errs.add(errRender, s.locator().templateError(field.path, err))
+		}
+		field.set(v)
 	}
-
-	return nil
 }
 
 type jsonIterator interface {
@@ -118,87 +207,136 @@ type jsonIterator interface {
 	Unmarshal(data []byte, object interface{}) error
 }
 
-func (s *Spec) validateSchema(path string, json jsonIterator) error {
-	// Create a reflector to build a JSON Schema from the Spec definition.
-	reflector := new(jsonschema.Reflector)
-	reflector.ExpandedStruct = true
-	schema := gojsonschema.NewGoLoader(reflector.Reflect(&Spec{}))
+// specSchema returns a JSON Schema built from the Spec definition.
+func specSchema() gojsonschema.JSONLoader {
+	return gojsonschema.NewGoLoader(reflectSchema(&Spec{}))
+}
 
+// validateSchema validates the spec file at path against the schema of Spec, reporting every
+// error at its position in the file, and decodes it into the spec.
+func (s *Spec) validateSchema(path string, json jsonIterator) error {
 	yamldata, err := os.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
+	nodes, yamlErr := newSpecLocator(path, yamldata)
+	s.nodes = nodes
+	if yamlErr != nil {
+		return (&SpecErrors{Errors: []FieldError{*yamlErr}}).orNil()
+	}
+
 	jsondata, err := yaml.YAMLToJSON(yamldata)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	data := gojsonschema.NewBytesLoader(jsondata)
-	result, _ := gojsonschema.Validate(schema, data)
-
-	if !result.Valid() {
-		var msg string
-		for idx, err := range result.Errors() {
-			if idx > 0 {
-				msg = fmt.Sprintf("%s\n\t%s", msg, err)
-			} else {
-				msg = err.String()
-			}
-		}
-
-		return fmt.Errorf("%w: %s\n\t%s", errValidate, path, msg)
+	fieldErrs, err := nodes.schemaErrors(jsondata)
+	if err != nil {
+		return err
+	}
+	if len(fieldErrs) > 0 {
+		return (&SpecErrors{Errors: fieldErrs}).orNil()
 	}
 
 	return json.Unmarshal(jsondata, s) //nolint:wrapcheck // No need to wrap this error
 }
 
 // NewSpec constructs and validates new Spec structs from a given file.
-func NewSpec(path string, output io.Writer) (*Spec, error) {
+// Its behavior may be adjusted with options such as WithLogger, WithStageOutput,
+// WithHTTPClient, WithSourceCache, WithWorkDir, WithLogDir and WithEnv.
+func NewSpec(path string, opts ...Option) (*Spec, error) {
+	o := newOptions(opts)
+
 	spec := new(Spec)
 	if err := spec.validateSchema(path, jsoniter.ConfigCompatibleWithStandardLibrary); err != nil {
 		return nil, err
 	}
 
-	if err := spec.renderAll(); err != nil {
-		return nil, err
+	spec.sourceCache = o.resolveSourceCache()
+	spec.httpclient = o.httpclient
+	spec.workRoot = o.workDir
+	spec.logDir = o.resolveLogDir()
+	spec.onlyStages = o.onlyStages
+	spec.skipStages = o.skipStages
+	spec.resumeDir = o.resume
+	if o.shellOnFailure {
+		spec.debugShell = interactiveShell()
 	}
-
-	if spec.sourceCache == "" {
-		user, _ := user.Current()
-		spec.sourceCache = user.HomeDir + configDir + srcDir
+	spec.fakeroot = o.fakeroot
+	spec.depVersions = o.depVersions
+	spec.repo = o.configuredRepo()
+	spec.path = path
+	spec.opts = opts
+	spec.buildUID = os.Getuid()
+	spec.buildGID = os.Getgid()
+	if spec.fakeroot {
+		spec.setupFakerootIDs()
 	}
+	spec.env = o.env
+	spec.profile = o.config.Profile
+	spec.log = withFields(o.log, "spec", spec.Name, "version", spec.Version)
+	spec.stdout = o.stdout
+	spec.stderr = o.stderr
+
+	spec.arch = valueOr(o.arch, hostArch())
+
+	errs := new(SpecErrors)
+	spec.validateOverrides(errs)
+	if len(errs.Errors) == 0 {
+		if err := spec.applyOverride(); err != nil {
+			return nil, err
+		}
+	}
+	spec.renderAll(errs)
 
 	for i := range spec.Sources {
+		field := spec.fieldPath(fmt.Sprintf("sources.%d.url", i))
+		if errs.has(field) {
+			// The URL could not be rendered.
+			continue
+		}
 		if err := spec.Sources[i].validateSource(); err != nil {
-			return nil, fmt.Errorf("%w", err)
+			errs.add(errSource, spec.nodes.fieldError(field, "%s", err))
+			continue
 		}
-		spec.Sources[i].output = output
 		if spec.Sources[i].protocol == httpProto && spec.httpclient == nil {
-			transport, _ := aia.NewTransport()
-			spec.httpclient = &http.Client{
-				Timeout:   time.Second * timeout,
-				Transport: transport,
-			}
+			spec.httpclient = newHTTPClient()
+		}
+	}
+
+	if spec.Upstream != nil {
+		if err := spec.Upstream.validate(); err != nil {
+			errs.add(errUpstream, spec.nodes.fieldError("upstream", "%s", err))
+		} else if spec.httpclient == nil &&
+			(spec.Upstream.Type == upstreamGitHub || !strings.HasPrefix(spec.Upstream.URL, fileProto)) {
+			spec.httpclient = newHTTPClient()
 		}
 	}
+	if err := errs.orNil(); err != nil {
+		return nil, err
+	}
+	spec.githubAPI = githubAPI
 
-	spec.buildOrder = []map[string]string{
-		{
-			"name": "build",
-			"cmd":  spec.Build,
-		},
-		{
-			"name": "test",
-			"cmd":  spec.Test,
-		},
-		{
-			"name": "install",
-			"cmd":  spec.Install,
-		},
+	if err := spec.setupStages(); err != nil {
+		return nil, err
+	}
+	if err := spec.setStageTimeouts(o.stageTimeouts); err != nil {
+		return nil, err
 	}
 
-	spec.output = output
+	timeout, err := parseTimeout(spec.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timeout: %w", errValidate, err)
+	}
+	spec.timeout = timeout
+	if o.timeout > 0 {
+		spec.timeout = o.timeout
+	}
+
+	if err := spec.setupLimits(o.config); err != nil {
+		return nil, err
+	}
 
 	return spec, nil
 }
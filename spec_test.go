@@ -2,6 +2,7 @@ package mere_test
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
 	"github.com/jhuntwork/mere"
@@ -30,48 +31,53 @@ func TestNewSpecErrors(t *testing.T) {
 		{
 			description: "Should fail when spec file contains invalid YAML",
 			filename:    "testdata/bad_yaml.txt",
-			errMsg:      "yaml: line 3: could not find expected ':'",
+			errMsg:      "invalid spec file:\ntestdata/bad_yaml.txt:2:1: could not find expected ':'",
 		},
 		{
 			description: "Should fail when spec file doesn't match the schema",
 			filename:    "testdata/bad_spec.yaml",
-			errMsg:      "invalid spec file: testdata/bad_spec.yaml\n\trelease: Invalid type. Expected: integer, given: string",
+			errMsg: "invalid spec file:\ntestdata/bad_spec.yaml:4:10: " +
+				"release: Invalid type. Expected: integer, given: string",
 		},
 		{
 			description: "Should fail when spec file doesn't contain all required fields",
 			filename:    "testdata/bad_template_missing_fields_spec.yaml",
-			errMsg: "invalid spec file: testdata/bad_template_missing_fields_spec.yaml\n\t(root): " +
-				"version is required\n\t(root): release is required",
+			errMsg: "invalid spec file:\ntestdata/bad_template_missing_fields_spec.yaml:1:1: version is required\n" +
+				"testdata/bad_template_missing_fields_spec.yaml:1:1: release is required",
 		},
 		{
 			description: "Should fail when spec file has unparseable template values",
 			filename:    "testdata/bad_template_spec.yaml",
-			errMsg:      `template: :1: bad character`,
+			errMsg:      "invalid spec file:\ntestdata/bad_template_spec.yaml:7:11: sources.0.url: bad character U+007D '}'",
 		},
 		{
 			description: "Should fail when spec file uses unknown fields as template values",
 			filename:    "testdata/bad_fields_spec.yaml",
-			errMsg:      `template: :1:2: executing "" at <.FakeField>: can't evaluate field FakeField in type *mere.Spec`,
+			errMsg: `testdata/bad_fields_spec.yaml:12:12: packages.0.files.0: executing "" at <.FakeField>: ` +
+				`can't evaluate field FakeField in type *mere.Spec`,
 		},
 		{
 			description: "Should fail when spec file has bad template data in the 'build' section",
 			filename:    "testdata/bad_template_build_spec.yaml",
-			errMsg:      `template: :1:17: executing "" at <.Versio>: can't evaluate field Versio in type *mere.Spec`,
+			errMsg: `testdata/bad_template_build_spec.yaml:21:20: build: executing "" at <.Versio>: ` +
+				`can't evaluate field Versio in type *mere.Spec`,
 		},
 		{
 			description: "Should fail when spec file has bad template data in the 'test' section",
 			filename:    "testdata/bad_template_test_spec.yaml",
-			errMsg:      `template: :1:17: executing "" at <.Versio>: can't evaluate field Versio in type *mere.Spec`,
+			errMsg: `testdata/bad_template_test_spec.yaml:21:20: test: executing "" at <.Versio>: ` +
+				`can't evaluate field Versio in type *mere.Spec`,
 		},
 		{
 			description: "Should fail when spec file has bad template data in the 'install' section",
 			filename:    "testdata/bad_template_install_spec.yaml",
-			errMsg:      `template: :1:17: executing "" at <.Versio>: can't evaluate field Versio in type *mere.Spec`,
+			errMsg: `testdata/bad_template_install_spec.yaml:21:20: install: executing "" at <.Versio>: ` +
+				`can't evaluate field Versio in type *mere.Spec`,
 		},
 		{
 			description: "Should fail when spec file has bad b3sum value",
 			filename:    "testdata/bad_b3sum_spec.yaml",
-			errMsg: "invalid spec file: testdata/bad_b3sum_spec.yaml\n\tsources.0.b3sum: " +
+			errMsg: "invalid spec file:\ntestdata/bad_b3sum_spec.yaml:8:12: sources.0.b3sum: " +
 				"String length must be greater than or equal to 64",
 		},
 		{
@@ -85,7 +91,7 @@ func TestNewSpecErrors(t *testing.T) {
 			t.Parallel()
 			assert := assert.New(t)
 			var buf bytes.Buffer
-			_, err := mere.NewSpec(tc.filename, &buf)
+			_, err := mere.NewSpec(tc.filename, mere.WithLogger(mere.Log{Output: &buf}))
 			assert.Contains(err.Error(), tc.errMsg)
 		})
 	}
@@ -96,9 +102,10 @@ func TestBuildSteps(t *testing.T) {
 	t.Run("Should execute a build stage", func(t *testing.T) {
 		t.Parallel()
 		var buf bytes.Buffer
-		spec, err := mere.NewSpec("testdata/spec_no_sources.yaml", &buf)
+		spec, err := mere.NewSpec("testdata/spec_no_sources.yaml",
+			mere.WithLogger(mere.Log{Output: &buf}), mere.WithStageOutput(&buf, &buf))
 		require.NoError(t, err)
-		err = spec.BuildSteps()
+		err = spec.BuildSteps(context.Background())
 		defer spec.Cleanup()
 		require.NoError(t, err)
 	})
@@ -0,0 +1,147 @@
+package mere
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	buildStage   = "build"
+	testStage    = "test"
+	installStage = "install"
+)
+
+var errUnknownStage = errors.New("unknown stage")
+
+// Stage defines a named command executed during the build.
+type Stage struct {
+	Name string `json:"name" jsonschema:"pattern=^[a-zA-Z0-9][a-zA-Z0-9_.-]*$" jsonschema_description:"Name of the stage"`
+	// Cmd may be omitted for stages named build, test or install, in which case
+	// the top-level field of the same name is used.
+	Cmd string `json:"cmd,omitempty" jsonschema_description:"Shell commands of the stage, by default those of the field named after the stage"`
+	// Workdir is the directory the command runs in, relative to the build context.
+	Workdir string `json:"workdir,omitempty" jsonschema_description:"Directory to run in, relative to the build context"`
+	// Env holds variables merged over the spec's env for this stage only.
+	Env map[string]string `json:"env,omitempty" jsonschema_description:"Environment variables of this stage only"`
+	// Timeout is the maximum duration of the stage, such as 30m.
+	Timeout string `json:"timeout,omitempty" jsonschema:"example=30m" jsonschema_description:"Maximum duration of the stage"`
+	timeout time.Duration
+}
+
+// shorthandStages returns the stages which may be defined through the top-level
+// build, test and install fields.
+func (s *Spec) shorthandStages() map[string]string {
+	return map[string]string{
+		buildStage:   s.Build,
+		testStage:    s.Test,
+		installStage: s.Install,
+	}
+}
+
+// setupStages determines the order in which stages are executed. Without a stages list, the
+// build, test and install fields are executed in that order. Otherwise the stages list is
+// used, and stages named build, test or install without a cmd take it from those fields.
+func (s *Spec) setupStages() error {
+	shorthand := s.shorthandStages()
+	if len(s.Stages) == 0 {
+		s.buildOrder = []Stage{
+			{Name: buildStage, Cmd: s.Build},
+			{Name: testStage, Cmd: s.Test},
+			{Name: installStage, Cmd: s.Install},
+		}
+		return nil
+	}
+
+	seen := make(map[string]bool, len(s.Stages))
+	s.buildOrder = make([]Stage, 0, len(s.Stages))
+	for _, stage := range s.Stages {
+		if seen[stage.Name] {
+			return fmt.Errorf("%w: duplicate stage %s", errValidate, stage.Name)
+		}
+		timeout, err := parseTimeout(stage.Timeout)
+		if err != nil {
+			return fmt.Errorf("%w: stage %s: %w", errValidate, stage.Name, err)
+		}
+		stage.timeout = timeout
+		seen[stage.Name] = true
+		if cmd, ok := shorthand[stage.Name]; ok && stage.Cmd == "" {
+			stage.Cmd = cmd
+		}
+		s.buildOrder = append(s.buildOrder, stage)
+	}
+	for _, name := range []string{buildStage, testStage, installStage} {
+		if shorthand[name] != "" && !seen[name] {
+			return fmt.Errorf("%w: %s is set but stage %s is not listed in stages", errValidate, name, name)
+		}
+	}
+	return nil
+}
+
+// parseTimeout parses an optional duration such as 30m or 2h.
+func parseTimeout(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	return d, nil
+}
+
+// setStageTimeouts overrides the timeouts of stages, by name.
+func (s *Spec) setStageTimeouts(timeouts map[string]time.Duration) error {
+	names := make([]string, 0, len(s.buildOrder))
+	for _, stage := range s.buildOrder {
+		names = append(names, stage.Name)
+	}
+	for _, name := range sortedKeys(timeouts) {
+		i := slices.Index(names, name)
+		if i < 0 {
+			return fmt.Errorf("%w: %s, expected one of %s", errUnknownStage, name, strings.Join(names, ", "))
+		}
+		s.buildOrder[i].timeout = timeouts[name]
+	}
+	return nil
+}
+
+// stageDir returns the directory in which a stage is executed.
+func (s *Spec) stageDir(stage Stage) string {
+	if stage.Workdir == "" {
+		return s.buildContext
+	}
+	if filepath.IsAbs(stage.Workdir) {
+		return stage.Workdir
+	}
+	return filepath.Join(s.buildContext, stage.Workdir)
+}
+
+// selectStages returns the stages to execute, honoring WithOnlyStages and WithSkipStages.
+func (s *Spec) selectStages() ([]Stage, error) {
+	known := make(map[string]bool, len(s.buildOrder))
+	names := make([]string, 0, len(s.buildOrder))
+	for _, stage := range s.buildOrder {
+		known[stage.Name] = true
+		names = append(names, stage.Name)
+	}
+	for _, name := range append(append([]string{}, s.onlyStages...), s.skipStages...) {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: %s, expected one of %s", errUnknownStage, name, strings.Join(names, ", "))
+		}
+	}
+	selected := make([]Stage, 0, len(s.buildOrder))
+	for _, stage := range s.buildOrder {
+		if len(s.onlyStages) > 0 && !slices.Contains(s.onlyStages, stage.Name) {
+			continue
+		}
+		if slices.Contains(s.skipStages, stage.Name) {
+			continue
+		}
+		selected = append(selected, stage)
+	}
+	return selected, nil
+}
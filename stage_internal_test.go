@@ -0,0 +1,167 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_setupStages(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		description string
+		spec        Spec
+		expected    []string
+		errMsg      string
+	}{
+		{
+			description: "Should default to build, test and install",
+			spec:        Spec{Build: "make", Install: "make install"},
+			expected:    []string{"build:make", "test:", "install:make install"},
+		},
+		{
+			description: "Should use the order of the stages list and fill in shorthand commands",
+			spec: Spec{
+				Install: "make install",
+				Stages:  []Stage{{Name: "configure", Cmd: "./configure"}, {Name: "install"}, {Name: "fixup", Cmd: "true"}},
+			},
+			expected: []string{"configure:./configure", "install:make install", "fixup:true"},
+		},
+		{
+			description: "Should prefer a stage's own command over the shorthand",
+			spec:        Spec{Build: "make", Stages: []Stage{{Name: "build", Cmd: "make -C src"}}},
+			expected:    []string{"build:make -C src"},
+		},
+		{
+			description: "Should fail on invalid timeouts",
+			spec:        Spec{Stages: []Stage{{Name: "build", Cmd: "make", Timeout: "soon"}}},
+			errMsg:      `invalid spec file: stage build: time: invalid duration "soon"`,
+		},
+		{
+			description: "Should fail on duplicate stages",
+			spec:        Spec{Stages: []Stage{{Name: "build", Cmd: "make"}, {Name: "build", Cmd: "make"}}},
+			errMsg:      "invalid spec file: duplicate stage build",
+		},
+		{
+			description: "Should fail when a shorthand field is not listed in stages",
+			spec:        Spec{Test: "make check", Stages: []Stage{{Name: "build", Cmd: "make"}}},
+			errMsg:      "invalid spec file: test is set but stage test is not listed in stages",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			err := tc.spec.setupStages()
+			if tc.errMsg != "" {
+				require.EqualError(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			order := make([]string, 0, len(tc.spec.buildOrder))
+			for _, stage := range tc.spec.buildOrder {
+				order = append(order, stage.Name+":"+stage.Cmd)
+			}
+			assert.Equal(t, tc.expected, order)
+		})
+	}
+}
+
+func TestBuildStepsWithStages(t *testing.T) {
+	t.Parallel()
+	t.Run("Should run custom stages with their own workdir and env", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_stages.yaml", WithLogger(Log{Output: &buf}), WithStageOutput(&buf, &buf))
+		require.NoError(t, err)
+		err = spec.BuildSteps(context.Background())
+		defer spec.Cleanup()
+		require.NoError(t, err, buf.String())
+		data, err := os.ReadFile(filepath.Join(spec.workingDir, pkg, "share/greeting"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello 1.0\n", string(data))
+		names := make([]string, 0, len(spec.Summary()))
+		for _, result := range spec.Summary() {
+			names = append(names, result.Name)
+		}
+		assert.Equal(t, []string{"prepare", "configure", "install", "fixup"}, names)
+	})
+}
+
+func Test_selectStages(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		description string
+		only        []string
+		skip        []string
+		expected    []string
+		errMsg      string
+	}{
+		{
+			description: "Should select every stage by default",
+			expected:    []string{"build", "test", "install"},
+		},
+		{
+			description: "Should skip the given stages",
+			skip:        []string{"test"},
+			expected:    []string{"build", "install"},
+		},
+		{
+			description: "Should only select the given stages",
+			only:        []string{"install", "build"},
+			expected:    []string{"build", "install"},
+		},
+		{
+			description: "Should fail on unknown stages",
+			skip:        []string{"check"},
+			errMsg:      "unknown stage: check, expected one of build, test, install",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			spec := Spec{onlyStages: tc.only, skipStages: tc.skip}
+			require.NoError(t, spec.setupStages())
+			stages, err := spec.selectStages()
+			if tc.errMsg != "" {
+				require.EqualError(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			names := make([]string, 0, len(stages))
+			for _, stage := range stages {
+				names = append(names, stage.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestWithStageTimeouts(t *testing.T) {
+	t.Parallel()
+	t.Run("Should override the timeouts of the named stages", func(t *testing.T) {
+		t.Parallel()
+		spec, err := NewSpec("testdata/spec_with_stages.yaml", WithConfig(Config{}),
+			WithStageTimeouts(map[string]time.Duration{"configure": time.Minute}),
+			WithStageTimeouts(map[string]time.Duration{"install": time.Hour}))
+		require.NoError(t, err)
+		timeouts := make(map[string]time.Duration, len(spec.buildOrder))
+		for _, stage := range spec.buildOrder {
+			timeouts[stage.Name] = stage.timeout
+		}
+		assert.Equal(t, map[string]time.Duration{
+			"prepare": 0, "configure": time.Minute, "install": time.Hour, "fixup": 0,
+		}, timeouts)
+	})
+	t.Run("Should fail on unknown stages", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewSpec("testdata/spec_with_stages.yaml", WithConfig(Config{}),
+			WithStageTimeouts(map[string]time.Duration{"check": time.Minute}))
+		require.ErrorIs(t, err, errUnknownStage)
+	})
+}
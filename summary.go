@@ -0,0 +1,142 @@
+package mere
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	logs          = "logs"
+	logFilePerm   = 0o644
+	summaryFile   = "summary.json"
+	logTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// StageResult records the outcome of a single build stage.
+type StageResult struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exitCode"`
+	Error    string        `json:"error,omitempty"`
+	LogFile  string        `json:"logFile"`
+	// PeakMemory is the peak memory use in bytes. It covers the whole stage when resource
+	// limits are enforced, otherwise only its largest single process.
+	PeakMemory int64 `json:"peakMemory,omitempty"`
+	// CPUTime is the user and system CPU time consumed by the stage.
+	CPUTime time.Duration `json:"cpuTime,omitempty"`
+}
+
+// Summary returns the results of each stage executed so far.
+func (s *Spec) Summary() []StageResult {
+	return s.results
+}
+
+// logDirs returns the directories in which stage logs are written.
+func (s *Spec) logDirs() []string {
+	dirs := []string{filepath.Join(s.workingDir, logs)}
+	if s.persistLogDir != "" {
+		dirs = append(dirs, s.persistLogDir)
+	}
+	return dirs
+}
+
+// timestampWriter prefixes every line written to it with the time it was written. The standard
+// output and error of a stage each have their own, sharing the lock of the log files.
+type timestampWriter struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	now     func() time.Time
+	midLine bool
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var buf bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		if !t.midLine {
+			buf.WriteString(t.now().UTC().Format(logTimeLayout) + " ")
+		}
+		buf.Write(line)
+		t.midLine = line[len(line)-1] != '\n'
+		rest = rest[len(line):]
+	}
+	if _, err := t.w.Write(buf.Bytes()); err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	return len(p), nil
+}
+
+// stageLog holds the writers of the standard output and error of a stage to its log files.
+type stageLog struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// openStageLogs creates a log file for the named stage in every log directory, returning
+// writers to all of them, which prefix each line with a timestamp, and a function which
+// closes them.
+func (s *Spec) openStageLogs(name string) (stageLog, func(), error) {
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	writers := make([]io.Writer, 0, len(s.logDirs()))
+	for _, dir := range s.logDirs() {
+		f, err := os.OpenFile(filepath.Join(dir, name+".log"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, logFilePerm)
+		if err != nil {
+			closeAll()
+			return stageLog{}, nil, fmt.Errorf("%w", err)
+		}
+		files = append(files, f)
+		writers = append(writers, f)
+	}
+	w, mu := io.MultiWriter(writers...), new(sync.Mutex)
+	return stageLog{
+		stdout: &timestampWriter{mu: mu, w: w, now: time.Now},
+		stderr: &timestampWriter{mu: mu, w: w, now: time.Now},
+	}, closeAll, nil
+}
+
+// recordStage adds the result of a stage to the summary and writes the summary to every log directory.
+func (s *Spec) recordStage(name string, start time.Time, usage stageUsage, err error) {
+	result := StageResult{
+		Name:       name,
+		Start:      start.UTC(),
+		Duration:   time.Since(start),
+		LogFile:    filepath.Join(s.logDirs()[len(s.logDirs())-1], name+".log"),
+		PeakMemory: usage.peakMemory,
+		CPUTime:    usage.cpuTime,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+	}
+	s.results = append(s.results, result)
+
+	data, _ := json.MarshalIndent(s.results, "", "  ")
+	for _, dir := range s.logDirs() {
+		if err := os.WriteFile(filepath.Join(dir, summaryFile), data, logFilePerm); err != nil {
+			s.log.Warn("Unable to write build summary: " + err.Error())
+		}
+	}
+}
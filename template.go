@@ -0,0 +1,132 @@
+package mere
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+const defaultPrefix = "/usr"
+
+// templateFuncs are the functions available to the templates of specs. Those taking the
+// string they operate on take it last, such that they can be used in pipelines, as in
+// {{.Version | replace "." "_"}}.
+var templateFuncs = template.FuncMap{
+	"majorMinor": majorMinor,
+	"replace":    func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       func(sep string, elems []string) string { return strings.Join(elems, sep) },
+}
+
+// majorMinorParts is the number of components of a version kept by majorMinor.
+const majorMinorParts = 2
+
+// majorMinor returns the first two components of a version, such as 1.2 for 1.2.3.
+func majorMinor(version string) string {
+	parts := strings.SplitN(version, ".", majorMinorParts+1)
+	return strings.Join(parts[:min(len(parts), majorMinorParts)], ".")
+}
+
+// goArches maps the architectures of Go to the names used by uname -m.
+var goArches = map[string]string{
+	"386":     "i686",
+	"amd64":   "x86_64",
+	"arm":     "armv7",
+	"arm64":   "aarch64",
+	"loong64": "loongarch64",
+}
+
+// hostArch returns the architecture of the host as named by uname -m, such as x86_64.
+func hostArch() string {
+	if arch, ok := goArches[runtime.GOARCH]; ok {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// newTemplate parses a template of a spec. Referring to a var which is not defined is an error.
+func newTemplate(v string) (*template.Template, error) {
+	tmpl := template.New("").Funcs(templateFuncs).Option("missingkey=error")
+	return tmpl.Parse(v) //nolint:wrapcheck // callers wrap the error
+}
+
+// Arch returns the architecture the spec is built for, such as x86_64, available to templates
+// as {{.Arch}}.
+func (s *Spec) Arch() string {
+	return valueOr(s.arch, hostArch())
+}
+
+// Jobs returns the number of parallel jobs of the build profile, available to templates as
+// {{.Jobs}}.
+func (s *Spec) Jobs() int {
+	return s.profile.jobs()
+}
+
+// Prefix returns the installation prefix of the build profile, available to templates as
+// {{.Prefix}}.
+func (s *Spec) Prefix() string {
+	return s.profile.prefix()
+}
+
+const (
+	visiting = iota + 1
+	visited
+)
+
+// varOrder returns the names of vars in the order they are rendered: every var after the vars
+// it refers to, and otherwise in lexical order. Vars which refer to each other in a cycle
+// cannot all be rendered first, the first cycle found is returned as the names along it.
+func varOrder(vars map[string]string) ([]string, []string) {
+	order := make([]string, 0, len(vars))
+	state := make(map[string]int, len(vars))
+	var path, cycle []string
+	var visit func(name string)
+	visit = func(name string) {
+		switch state[name] {
+		case visited:
+			return
+		case visiting:
+			if cycle == nil {
+				cycle = append(slices.Clone(path[slices.Index(path, name):]), name)
+			}
+			return
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, ref := range varRefs(vars[name]) {
+			if _, ok := vars[ref]; ok {
+				visit(ref)
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, name)
+	}
+	for _, name := range sortedKeys(vars) {
+		visit(name)
+	}
+	return order, cycle
+}
+
+// varRefs returns the names of the vars a template refers to as .Vars.name. Templates which
+// do not parse refer to none, their errors are reported when rendering them.
+func varRefs(value string) []string {
+	tmpl, err := newTemplate(value)
+	if err != nil {
+		return nil
+	}
+	var fields [][]string
+	templateFields(tmpl.Root, &fields)
+	var refs []string
+	for _, ident := range fields {
+		if len(ident) > 1 && ident[0] == "Vars" {
+			refs = append(refs, ident[1])
+		}
+	}
+	return refs
+}
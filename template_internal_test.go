@@ -0,0 +1,94 @@
+package mere
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_majorMinor(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"1.2.3":   "1.2",
+		"3.24.41": "3.24",
+		"1.2":     "1.2",
+		"7":       "7",
+		"1.2.3.4": "1.2",
+	}
+	for version, expected := range tests {
+		t.Run(version, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, expected, majorMinor(version))
+		})
+	}
+}
+
+func Test_varOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		vars  map[string]string
+		order []string
+		cycle []string
+	}{
+		{
+			name:  "Should render vars in lexical order without references",
+			vars:  map[string]string{"b": "{{.Version}}", "a": "x"},
+			order: []string{"a", "b"},
+		},
+		{
+			name:  "Should render vars after the vars they refer to",
+			vars:  map[string]string{"a": "{{.Vars.c}}/{{.Vars.b}}", "b": "{{.Vars.c}}", "c": "x", "d": "{{.Vars.unknown}}"},
+			order: []string{"c", "b", "a", "d"},
+		},
+		{
+			name:  "Should return a cycle",
+			vars:  map[string]string{"a": "{{.Vars.b}}", "b": "{{if .Vars.c}}{{end}}", "c": "{{.Vars.a}}"},
+			order: []string{"c", "b", "a"},
+			cycle: []string{"a", "b", "c", "a"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			order, cycle := varOrder(tc.vars)
+			assert.Equal(t, tc.order, order)
+			assert.Equal(t, tc.cycle, cycle)
+		})
+	}
+}
+
+func TestSpecTemplates(t *testing.T) {
+	t.Parallel()
+	t.Run("Should render functions, vars and build values", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		spec, err := NewSpec("testdata/spec_with_vars.yaml", WithLogger(Log{Output: &buf}),
+			WithConfig(Config{Profile: BuildProfile{Jobs: 3, Prefix: "/opt"}}))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"series": "3.24", "underscored": "3_24_41", "major": "3", "full": "3.24.41", "micro": "41",
+		}, spec.Vars)
+		assert.Equal(t, "GTK 3.24 toolkit", spec.Description)
+		assert.Equal(t, "https://download.gnome.org/sources/gtk/3.24", spec.Home)
+		assert.Equal(t, []string{"gtk3-data"}, spec.Packages[0].Deps)
+		assert.Equal(t, []string{"opt/lib"}, spec.Packages[0].Files)
+		assert.Equal(t, "make -j3 ARCH="+hostArch()+" TAG=3_24_41\n", spec.Build)
+	})
+	t.Run("Should fail on vars which refer to each other in a cycle", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		_, err := NewSpec("testdata/spec_with_var_cycle.yaml", WithLogger(Log{Output: &buf}))
+		require.ErrorIs(t, err, errRender)
+		require.ErrorContains(t, err,
+			"spec_with_var_cycle.yaml:7:6: vars.a: vars refer to each other in a cycle: a -> b -> a")
+	})
+	t.Run("Should fail on a var which is not defined", func(t *testing.T) {
+		t.Parallel()
+		spec := &Spec{Vars: map[string]string{"series": "1.2"}}
+		_, err := spec.render("{{.Vars.serie}}")
+		require.ErrorContains(t, err, `map has no entry for key "serie"`)
+	})
+}
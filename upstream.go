@@ -0,0 +1,193 @@
+package mere
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	upstreamURL    = "url"
+	upstreamGitHub = "github"
+	githubAPI      = "https://api.github.com"
+	// maxUpstreamBody limits how much of an upstream listing is read.
+	maxUpstreamBody = 16 << 20
+)
+
+var (
+	errUpstream          = errors.New("invalid upstream")
+	errNoUpstreamVersion = errors.New("no upstream version found")
+	defaultTagRegex      = regexp.MustCompile(`^v?(\d.*)$`)
+)
+
+// Upstream describes where to find the latest version of the software a spec builds.
+type Upstream struct {
+	// Type is url, to search a page for versions, or github, to list the releases of a repository.
+	Type string `json:"type,omitempty" jsonschema:"enum=url,enum=github" jsonschema_description:"url to search a page for versions, or github to list the releases of a repository"`
+	// URL is the page listing versions, for the url type.
+	URL string `json:"url,omitempty" jsonschema_description:"Page listing versions, for the url type"`
+	// Regex matches versions in the page, or in GitHub release tags. Its first capture group,
+	// if any, is the version. For github it defaults to ^v?(\d.*)$.
+	Regex string `json:"regex,omitempty" jsonschema_description:"Regular expression matching versions, its first capture group is the version"`
+	// Repo is the owner/name of the GitHub repository, for the github type.
+	Repo  string `json:"repo,omitempty" jsonschema:"pattern=^[^/]+/[^/]+$" jsonschema_description:"owner/name of the GitHub repository, for the github type"`
+	regex *regexp.Regexp
+}
+
+// UpdateResult records the outcome of checking the upstream of a spec.
+type UpdateResult struct {
+	Spec     string `json:"spec"`
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Upstream string `json:"upstream,omitempty"`
+	// Newer is true when the upstream version is newer than the spec's version.
+	Newer bool   `json:"newer"`
+	Error string `json:"error,omitempty"`
+}
+
+// validate checks the upstream section and compiles its regex.
+func (u *Upstream) validate() error {
+	if u.Type == "" {
+		u.Type = upstreamURL
+	}
+	var err error
+	switch u.Type {
+	case upstreamURL:
+		if u.URL == "" || u.Regex == "" {
+			return fmt.Errorf("%w: url and regex are required", errUpstream)
+		}
+		if _, err := validateURL(u.URL); err != nil {
+			return fmt.Errorf("%w: %w", errUpstream, err)
+		}
+	case upstreamGitHub:
+		if owner, name, ok := strings.Cut(u.Repo, "/"); !ok || owner == "" || name == "" {
+			return fmt.Errorf("%w: repo must be owner/name", errUpstream)
+		}
+		u.regex = defaultTagRegex
+	default:
+		return fmt.Errorf("%w: unknown type %s", errUpstream, u.Type)
+	}
+	if u.Regex != "" {
+		if u.regex, err = regexp.Compile(u.Regex); err != nil {
+			return fmt.Errorf("%w: %w", errUpstream, err)
+		}
+	}
+	return nil
+}
+
+// match returns every version matched by the upstream regex in s.
+func (u *Upstream) match(s string) []string {
+	var versions []string
+	for _, m := range u.regex.FindAllStringSubmatch(s, -1) {
+		if len(m) > 1 {
+			versions = append(versions, m[1])
+		} else {
+			versions = append(versions, m[0])
+		}
+	}
+	return versions
+}
+
+// readUpstream returns the contents of an upstream listing, which may be a local file.
+func (s *Spec) readUpstream(ctx context.Context, u string) ([]byte, error) {
+	parsed, err := validateURL(u)
+	if err != nil {
+		return nil, err
+	}
+	var r io.ReadCloser
+	if parsed.Scheme == fileProto {
+		if r, err = os.Open(parsed.Path); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+	} else if r, err = httpGet(ctx, s.httpclient, u); err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxUpstreamBody))
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return data, nil
+}
+
+// githubRelease holds the fields of a release returned by the GitHub releases API.
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// upstreamVersions returns every version listed by the spec's upstream.
+func (s *Spec) upstreamVersions(ctx context.Context) ([]string, error) {
+	u := s.Upstream
+	if u.Type == upstreamURL {
+		data, err := s.readUpstream(ctx, u.URL)
+		if err != nil {
+			return nil, err
+		}
+		return u.match(string(data)), nil
+	}
+	data, err := s.readUpstream(ctx, fmt.Sprintf("%s/repos/%s/releases", s.githubAPI, u.Repo))
+	if err != nil {
+		return nil, err
+	}
+	var releases []githubRelease
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	var versions []string
+	for _, release := range releases {
+		if !release.Draft && !release.Prerelease {
+			versions = append(versions, u.match(release.TagName)...)
+		}
+	}
+	return versions, nil
+}
+
+// UpstreamVersion returns the newest version listed by the spec's upstream.
+func (s *Spec) UpstreamVersion(ctx context.Context) (string, error) {
+	if s.Upstream == nil {
+		return "", fmt.Errorf("%w: %s has no upstream", errUpstream, s.Name)
+	}
+	versions, err := s.upstreamVersions(ctx)
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	for _, version := range versions {
+		if newest == "" || CompareVersions(version, newest) > 0 {
+			newest = version
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("%w", errNoUpstreamVersion)
+	}
+	return newest, nil
+}
+
+// CheckUpdates compares the version of each spec with an upstream with the newest version
+// available upstream. Specs without an upstream are left out of the results.
+func CheckUpdates(ctx context.Context, specs []*Spec) []UpdateResult {
+	results := make([]UpdateResult, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Upstream == nil {
+			continue
+		}
+		result := UpdateResult{Spec: spec.Name, Path: spec.path, Version: spec.Version}
+		version, err := spec.UpstreamVersion(ctx)
+		if err != nil {
+			spec.log.Warn(fmt.Sprintf("Unable to check upstream of %s: %s", spec.Name, err))
+			result.Error = err.Error()
+		} else {
+			result.Upstream = version
+			result.Newer = CompareVersions(version, spec.Version) > 0
+		}
+		results = append(results, result)
+	}
+	return results
+}
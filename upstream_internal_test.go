@@ -0,0 +1,101 @@
+package mere
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureHTTP serves the files below testdata/upstream by request path.
+type fixtureHTTP struct {
+	requests []string
+}
+
+func (f *fixtureHTTP) Do(req *http.Request) (*http.Response, error) {
+	f.requests = append(f.requests, req.URL.String())
+	data, err := os.ReadFile(filepath.Join("testdata/upstream", req.URL.Path))
+	if err != nil {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(&bytes.Buffer{})}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func TestCheckUpdates(t *testing.T) {
+	t.Parallel()
+	load := func(t *testing.T, client HTTPClient, paths ...string) []*Spec {
+		t.Helper()
+		var buf bytes.Buffer
+		specs := make([]*Spec, 0, len(paths))
+		for _, path := range paths {
+			spec, err := NewSpec(path, WithLogger(Log{Output: &buf}), WithHTTPClient(client))
+			require.NoError(t, err)
+			specs = append(specs, spec)
+		}
+		return specs
+	}
+	t.Run("Should report newer versions from a page and GitHub releases", func(t *testing.T) {
+		t.Parallel()
+		client := &fixtureHTTP{}
+		specs := load(t, client, "testdata/spec_with_upstream.yaml", "testdata/spec_with_github_upstream.yaml",
+			"testdata/spec_no_sources.yaml")
+		results := CheckUpdates(context.Background(), specs)
+		assert.Equal(t, []UpdateResult{
+			{Spec: "hello", Path: "testdata/spec_with_upstream.yaml", Version: "1.9", Upstream: "1.10", Newer: true},
+			{Spec: "hello", Path: "testdata/spec_with_github_upstream.yaml", Version: "2.0.1", Upstream: "2.0.1"},
+		}, results)
+		assert.Equal(t, []string{
+			"https://example.com/releases/hello.html",
+			"https://api.github.com/repos/example/hello/releases",
+		}, client.requests)
+	})
+	t.Run("Should record errors fetching the upstream", func(t *testing.T) {
+		t.Parallel()
+		specs := load(t, &serverErrHTTP{}, "testdata/spec_with_upstream.yaml")
+		results := CheckUpdates(context.Background(), specs)
+		require.Len(t, results, 1)
+		assert.Equal(t, "received an HTTP error: 500 Internal Server Error", results[0].Error)
+	})
+	t.Run("Should fail when nothing matches", func(t *testing.T) {
+		t.Parallel()
+		specs := load(t, &goodHTTP{}, "testdata/spec_with_upstream.yaml")
+		_, err := specs[0].UpstreamVersion(context.Background())
+		require.EqualError(t, err, "no upstream version found")
+	})
+}
+
+func TestUpstreamValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		description string
+		upstream    Upstream
+		errMsg      string
+	}{
+		{description: "Should require a regex", upstream: Upstream{URL: "https://example.com"},
+			errMsg: "invalid upstream: url and regex are required"},
+		{description: "Should require a valid regex", upstream: Upstream{URL: "https://example.com", Regex: "("},
+			errMsg: "invalid upstream: error parsing regexp: missing closing ): `(`"},
+		{description: "Should require a GitHub repo", upstream: Upstream{Type: "github", Repo: "hello"},
+			errMsg: "invalid upstream: repo must be owner/name"},
+		{description: "Should reject unknown types", upstream: Upstream{Type: "svn"},
+			errMsg: "invalid upstream: unknown type svn"},
+		{description: "Should accept a GitHub repo", upstream: Upstream{Type: "github", Repo: "example/hello"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			err := tc.upstream.validate()
+			if tc.errMsg != "" {
+				require.EqualError(t, err, tc.errMsg)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
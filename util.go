@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 
 	"github.com/codeclysm/extract/v3"
 	"github.com/zeebo/blake3"
@@ -35,6 +36,16 @@ func ensureDir(md mkdirall, path string) error {
 	return nil
 }
 
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func computeB3Sum(f io.Reader) (string, error) {
 	var buf []byte
 	hash := blake3.New()
@@ -54,8 +65,13 @@ func computeB3SumFromFile(filename string) (string, error) {
 	return computeB3Sum(f)
 }
 
-func (source *Source) checkB3SumFromFile(filename string, b3sum string) error {
-	fmt.Fprintf(source.output, "Validating %s\n", filename)
+func checkB3SumFromFile(log Logger, filename string, b3sum string) error {
+	log.Info("Validating " + filename)
+	return checkB3Sum(filename, b3sum)
+}
+
+// checkB3Sum fails when the BLAKE3 sum of filename is not b3sum.
+func checkB3Sum(filename string, b3sum string) error {
 	sum, err := computeB3SumFromFile(filename)
 	if err != nil {
 		return err
@@ -67,13 +83,13 @@ func (source *Source) checkB3SumFromFile(filename string, b3sum string) error {
 }
 
 // Given a filename and directory, treat filename as an archive and extract its contents to the directory.
-func extractArchive(filepath string, dir string) error {
+func extractArchive(ctx context.Context, filepath string, dir string) error {
 	f, err := os.Open(filepath)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 	defer f.Close()
-	err = extract.Archive(context.Background(), f, dir, nil)
+	err = extract.Archive(ctx, f, dir, nil)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
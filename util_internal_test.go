@@ -2,6 +2,7 @@ package mere
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -63,8 +64,7 @@ func Test_checkB3SumFromFile(t *testing.T) {
 	t.Run("should not fail when file sum matches", func(t *testing.T) {
 		t.Parallel()
 		var buf bytes.Buffer
-		source := Source{output: &buf}
-		err := source.checkB3SumFromFile(
+		err := checkB3SumFromFile(Log{Output: &buf},
 			"testdata/spec.yaml",
 			goodSpecB3Sum)
 		require.NoError(t, err)
@@ -73,8 +73,7 @@ func Test_checkB3SumFromFile(t *testing.T) {
 		t.Parallel()
 		var buf bytes.Buffer
 		os.RemoveAll(sourceCache)
-		source := Source{output: &buf}
-		err := source.checkB3SumFromFile(
+		err := checkB3SumFromFile(Log{Output: &buf},
 			sourceCache+"/spec.yaml",
 			"not_a_b3sum_sum")
 		require.EqualError(t, err, "open testdata/src/spec.yaml: no such file or directory")
@@ -137,13 +136,13 @@ func Test_extractArchive(t *testing.T) {
 	t.Run("Should fail on missing archives", func(t *testing.T) {
 		t.Parallel()
 		assert := assert.New(t)
-		err := extractArchive("testdata/no-such-file", "/tmp")
+		err := extractArchive(context.Background(), "testdata/no-such-file", "/tmp")
 		assert.EqualError(err, "open testdata/no-such-file: no such file or directory")
 	})
 	t.Run("Should fail on bad archives", func(t *testing.T) {
 		t.Parallel()
 		assert := assert.New(t)
-		err := extractArchive("testdata/spec.yaml", "/tmp")
+		err := extractArchive(context.Background(), "testdata/spec.yaml", "/tmp")
 		assert.Contains(err.Error(), "Not a supported archive")
 	})
 	t.Run("Should extract good archives", func(t *testing.T) {
@@ -151,7 +150,7 @@ func Test_extractArchive(t *testing.T) {
 		assert := assert.New(t)
 		tmpDir, _ := os.MkdirTemp("", "testarchive-*")
 		defer os.RemoveAll(tmpDir)
-		err := extractArchive("testdata/testarchive.tar.gz", tmpDir)
+		err := extractArchive(context.Background(), "testdata/testarchive.tar.gz", tmpDir)
 		require.NoError(t, err)
 		assert.NotEqual("", tmpDir)
 		_, err = os.Stat(tmpDir + "/testdata/spec.yaml")
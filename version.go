@@ -0,0 +1,96 @@
+package mere
+
+import (
+	"strings"
+	"unicode"
+)
+
+// CompareVersions compares two version strings, returning -1, 0 or 1 when a is older than,
+// equal to or newer than b.
+//
+// Versions are compared segment by segment, where a segment is a run of digits or of
+// letters and any other characters only separate segments. Numeric segments compare
+// numerically and are newer than alphabetic ones, which compare lexically. A version with
+// additional segments is newer, unless the next segment of it is preceded by a tilde,
+// which marks a pre-release such that 1.0~rc1 is older than 1.0.
+func CompareVersions(a, b string) int {
+	for {
+		a = strings.TrimLeftFunc(a, isVersionSeparator)
+		b = strings.TrimLeftFunc(b, isVersionSeparator)
+		tildeA, tildeB := strings.HasPrefix(a, "~"), strings.HasPrefix(b, "~")
+		switch {
+		case tildeA && tildeB:
+			a, b = a[1:], b[1:]
+			continue
+		case tildeA:
+			return -1
+		case tildeB:
+			return 1
+		case a == "" && b == "":
+			return 0
+		case a == "":
+			return -1
+		case b == "":
+			return 1
+		}
+		var segA, segB string
+		numeric := unicode.IsDigit(rune(a[0]))
+		segA, a = versionSegment(a, numeric)
+		segB, b = versionSegment(b, numeric)
+		if segB == "" {
+			// Segments of different types, numeric ones are newer.
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				return compareInts(len(segA), len(segB))
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+}
+
+// versionSegment splits the leading run of digits, or of letters, from v.
+func versionSegment(v string, numeric bool) (string, string) {
+	end := strings.IndexFunc(v, func(r rune) bool {
+		if numeric {
+			return !unicode.IsDigit(r)
+		}
+		return !unicode.IsLetter(r)
+	})
+	if end < 0 {
+		return v, ""
+	}
+	return v[:end], v[end:]
+}
+
+func isVersionSeparator(r rune) bool {
+	return r != '~' && !unicode.IsDigit(r) && !unicode.IsLetter(r)
+}
+
+func compareInts[T int | int64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareFullVersions compares two versions along with their releases, the release is only
+// compared when the versions are equal.
+func compareFullVersions(versionA string, releaseA int64, versionB string, releaseB int64) int {
+	if c := CompareVersions(versionA, versionB); c != 0 {
+		return c
+	}
+	return compareInts(releaseA, releaseB)
+}
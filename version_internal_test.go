@@ -0,0 +1,46 @@
+package mere
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "1.0", b: "1.0", expected: 0},
+		{a: "1.0", b: "1_0", expected: 0},
+		{a: "1.0", b: "1.1", expected: -1},
+		{a: "1.10", b: "1.9", expected: 1},
+		{a: "1.01", b: "1.1", expected: 0},
+		{a: "1.0", b: "1.0.1", expected: -1},
+		{a: "2.0", b: "1.99.99", expected: 1},
+		{a: "1.0a", b: "1.0b", expected: -1},
+		{a: "1.0a", b: "1.0", expected: 1},
+		{a: "1.0.1", b: "1.0a", expected: 1},
+		{a: "1.0~rc1", b: "1.0", expected: -1},
+		{a: "1.0~rc1", b: "1.0~rc2", expected: -1},
+		{a: "1.0", b: "1.0~rc1", expected: 1},
+		{a: "20240101", b: "20231231", expected: 1},
+		{a: "alpha", b: "beta", expected: -1},
+		{a: "", b: "1", expected: -1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, CompareVersions(tc.a, tc.b))
+			assert.Equal(t, -tc.expected, CompareVersions(tc.b, tc.a))
+		})
+	}
+}
+
+func Test_compareFullVersions(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 1, compareFullVersions("1.0", 2, "1.0", 1))
+	assert.Equal(t, -1, compareFullVersions("1.0", 9, "1.1", 1))
+	assert.Equal(t, 0, compareFullVersions("1.0", 1, "1.0", 1))
+}